@@ -2,49 +2,179 @@ package slackchatops
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 // Action represents what the system should perform. This is typically some type of command
 type Action struct {
-	Name            string   // friendly name of the action
-	Description     string   // description of the action
-	Command         string   // actual command being called
-	WorkingDir      string   // working directory for the command to be called in
-	Params          []string // parameters the command needs to run. When executed the user will pass these in as arguments. They will be appended to the Args list
-	Args            []string // arguments to pass to the command. If any are predefined in the config.yaml file (defaults) then user passed arguments (Params) will be appended to the end
-	OutputFile      string   // if the command being executed writes to a file. StdErr and StdOut are already captured. This could be an html document from a set of unit tests for example
-	AuthorizedUsers []string // list of autorized users that are allowed to execute this action. This should be their slackId
+	Name             string            // friendly name of the action
+	Description      string            // description of the action
+	Category         string            // actions are grouped by category in help
+	Usage            []string          // examples shown by help <action> (ex: deploy 1.4.2 staging)
+	Help             string            // longer explanation shown by help <action>
+	Command          string            // actual command being called
+	WorkingDir       string            // working directory for the command to be called in
+	Env              map[string]string // environment variables of the command, added to Config.Env. Values may be env:NAME, file:path or secret:name
+	Params           []Param           // parameters the command needs to run. When executed the user will pass these in as arguments. They will be appended to the Args list
+	Args             []string          // arguments to pass to the command. If any are predefined in the config.yaml file (defaults) then user passed arguments (Params) will be appended to the end
+	OutputFile       string            // if the command being executed writes to a file. StdErr and StdOut are already captured. This could be an html document from a set of unit tests for example
+	OutputFiles      []string          // glob patterns (ex: reports/*.html) of files or directories uploaded once the command finished. Relative to WorkingDir
+	Bundle           bool              // zip every output file into a single archive instead of uploading them one by one
+	MaxUploadMB      int               // output files larger than this are left in place instead of being uploaded. Defaults to Config.MaxUploadMB
+	AfterUpload      string            // what happens to uploaded output files: delete (default), keep or archive
+	ArchiveDir       string            // directory output files are moved to when AfterUpload is archive. Defaults to Config.ArchiveDir
+	AuthorizedUsers  []string          // list of autorized users that are allowed to execute this action. This should be their slackId
+	Timeout          time.Duration     // maximum time the command may run before it (and any child processes) is killed. Zero means no limit
+	GracePeriod      time.Duration     // how long a cancelled command is given to exit after being signalled before it is killed. Defaults to DefaultGracePeriod
+	Concurrency      string            // how overlapping requests are handled: parallel, exclusive (default) or queue
+	LockGroup        string            // actions sharing a lock group are exclusive (or queued) with each other instead of just themselves
+	Stream           bool              // post the output to Slack while the command is running instead of only once it finishes
+	Replies          string            // where replies go: thread (default), quiet or channel. Defaults to Config.Replies
+	NoReactions      bool              // don't add reactions showing whether the action is queued, running, succeeded or failed to the command
+	Output           Output            // how the result is posted (ex: json, csvtable or a template). Defaults to the plain output
+	InlineLines      int               // output longer than this is uploaded as a file with a preview of its start and end. Defaults to Config.InlineLines
+	PreviewLines     int               // lines of the start and end of long output shown in the preview. Defaults to Config.PreviewLines
+	Confirm          Confirm           // true (or the question to ask) makes the requester confirm the exact command line before it runs
+	RequiresApproval bool              // the action only runs after enough Approvers sign off on the request
+	Approvers        []string          // slackIds, roles or Slack user group ids allowed to approve the action
+	MinApprovals     int               // number of distinct approvers needed. Defaults to 1
+	Allow            []Rule            // roles, users or * allowed to run the action, optionally only in some channels
+	Deny             []Rule            // roles, users or * never allowed to run the action. Deny wins over Allow
+
+	env    []string // resolved Env (and Config.Env) as NAME=value
+	masker *masker  // hides the values read from the environment, files or secrets in the output
 }
 
+// DefaultGracePeriod is used when an action doesn't define its own GracePeriod
+const DefaultGracePeriod = 5 * time.Second
+
+// Concurrency policies for an action
+const (
+	ConcurrencyParallel  = "parallel"  // any number of instances may run at once
+	ConcurrencyExclusive = "exclusive" // requests are rejected while the action (or its lock group) is running
+	ConcurrencyQueue     = "queue"     // requests wait their turn while the action (or its lock group) is running
+)
+
+// Where the replies to an action go
+const (
+	RepliesThread  = "thread"  // in a thread under the command, with a one line summary in the channel once it finished
+	RepliesQuiet   = "quiet"   // in a thread under the command, without the summary
+	RepliesChannel = "channel" // in the channel
+)
+
+// Reactions added to the command while an action runs
+const (
+	ReactionQueued    = "hourglass_flowing_sand"
+	ReactionRunning   = "gear"
+	ReactionSucceeded = "white_check_mark"
+	ReactionFailed    = "x"
+)
+
 // Result of an Action being executed on the system
 type Result struct {
 	ReturnCode int
 	StdOut     string
 	StdError   string
+	TimedOut   bool // true when the command was killed because it ran longer than the action's Timeout
+	Cancelled  bool // true when the command was stopped because its context was cancelled
 }
 
 // Run actually executes the command
 func (a *Action) Run(args ...string) (Result, error) {
+	return a.RunContext(context.Background(), args...)
+}
+
+// RunContext executes the command and stops its whole process group when either
+// the context is cancelled or the action's Timeout expires. A cancelled command is
+// signalled first and only killed if it is still running after the GracePeriod
+func (a *Action) RunContext(ctx context.Context, args ...string) (Result, error) {
+	return a.run(ctx, nil, nil, args)
+}
+
+// RunStream executes the command like RunContext while also sending every line written
+// to stdout or stderr to the lines channel as it is produced. The channel is closed once
+// the command has finished. The caller must keep reading from it or the command will stall.
+// The lines aren't masked since a secret may span several of them. Mask the text built from them instead
+func (a *Action) RunStream(ctx context.Context, lines chan<- string, args ...string) (Result, error) {
+	stdout, stderr := &lineWriter{lines: lines}, &lineWriter{lines: lines}
+	defer close(lines)
+	defer stderr.Flush()
+	defer stdout.Flush()
+	return a.run(ctx, stdout, stderr, args)
+}
+
+func (a *Action) run(ctx context.Context, stdoutCopy io.Writer, stderrCopy io.Writer, args []string) (Result, error) {
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+
 	mergedArgs := a.ParseArgs(args)
 	cmd := exec.Command(a.Command, mergedArgs...)
 	if a.WorkingDir != "" {
 		path, _ := ExpandPath(a.WorkingDir)
 		cmd.Dir = path
 	}
+	if len(a.env) > 0 {
+		cmd.Env = append(os.Environ(), a.env...)
+	}
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	err := cmd.Run()
+	if stdoutCopy != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, stdoutCopy)
+	}
+	if stderrCopy != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, stderrCopy)
+	}
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
+	timedOut, cancelled := false, false
+	if err == nil {
+		// watch the context while the command runs. The process group is stopped so
+		// children spawned by shell scripts don't keep the output pipes open
+		done := make(chan struct{})
+		killed := make(chan bool, 1)
+		go func() {
+			select {
+			case <-ctx.Done():
+				if ctx.Err() == context.Canceled {
+					terminateProcessGroup(cmd)
+					select {
+					case <-done:
+						killed <- true
+						return
+					case <-time.After(a.gracePeriod()):
+					}
+				}
+				killProcessGroup(cmd)
+				killed <- true
+			case <-done:
+				killed <- false
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+		if <-killed {
+			timedOut = ctx.Err() == context.DeadlineExceeded
+			cancelled = ctx.Err() == context.Canceled
+		}
+	}
 	exitCode := 0
-	outStr, errStr := stdout.String(), stderr.String()
+	outStr, errStr := a.masker.Mask(stdout.String()), a.masker.Mask(stderr.String())
 
 	if err != nil {
 		// try to get the exit code
@@ -59,7 +189,7 @@ func (a *Action) Run(args ...string) (Result, error) {
 			log.Printf("Could not get exit code for failed program: %v, %v", a.Command, a.Args)
 			exitCode = 1
 			if errStr == "" {
-				errStr = err.Error()
+				errStr = a.masker.Mask(err.Error())
 			}
 		}
 	} else {
@@ -72,9 +202,80 @@ func (a *Action) Run(args ...string) (Result, error) {
 		ReturnCode: exitCode,
 		StdError:   errStr,
 		StdOut:     outStr,
+		TimedOut:   timedOut,
+		Cancelled:  cancelled,
 	}, err
 }
 
+// RequiredApprovals returns the number of distinct approvals the action needs
+func (a *Action) RequiredApprovals() int {
+	if a.MinApprovals > 0 {
+		return a.MinApprovals
+	}
+	return 1
+}
+
+func (a *Action) gracePeriod() time.Duration {
+	if a.GracePeriod > 0 {
+		return a.GracePeriod
+	}
+	return DefaultGracePeriod
+}
+
+// IsRestricted returns true when only some users may run the action
+func (a *Action) IsRestricted() bool {
+	return len(a.AuthorizedUsers) > 0 || len(a.Allow) > 0 || len(a.Deny) > 0
+}
+
+// Validate will ensure the action is configured correctly
+func (a *Action) Validate() error {
+	switch a.Concurrency {
+	case "", ConcurrencyParallel, ConcurrencyExclusive, ConcurrencyQueue:
+	default:
+		return fmt.Errorf("Action %s has unknown concurrency %s. Must be one of %s, %s or %s", a.Name, a.Concurrency, ConcurrencyParallel, ConcurrencyExclusive, ConcurrencyQueue)
+	}
+	switch a.Replies {
+	case "", RepliesThread, RepliesQuiet, RepliesChannel:
+	default:
+		return fmt.Errorf("Action %s has unknown replies %s. Must be one of %s, %s or %s", a.Name, a.Replies, RepliesThread, RepliesQuiet, RepliesChannel)
+	}
+	for name := range a.Env {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return fmt.Errorf("Action %s has invalid env name %q", a.Name, name)
+		}
+	}
+	if a.RequiresApproval && len(a.Approvers) == 0 {
+		return fmt.Errorf("Action %s requires approval but has no approvers", a.Name)
+	}
+	for _, p := range a.Params {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("Action %s: %v", a.Name, err)
+		}
+	}
+	if a.Stream && a.Output.Format != "" {
+		return fmt.Errorf("Action %s streams its output so it can't use output %s", a.Name, a.Output.Format)
+	}
+	if err := a.validateOutputFiles(); err != nil {
+		return err
+	}
+	if err := a.Output.Validate(); err != nil {
+		return fmt.Errorf("Action %s: %v", a.Name, err)
+	}
+	return a.ValidateArgs()
+}
+
+// LockKey returns the name of the lock that must be held while the action runs.
+// Parallel actions don't need a lock and return an empty string
+func (a *Action) LockKey() string {
+	if a.Concurrency == ConcurrencyParallel {
+		return ""
+	}
+	if a.LockGroup != "" {
+		return "group:" + a.LockGroup
+	}
+	return "action:" + a.Name
+}
+
 // ValidateArgs will ensure all tokenized parameters {x} have been replaced
 func (a *Action) ValidateArgs() error {
 	//ensure given number of params we have same number of tokens
@@ -88,12 +289,12 @@ func (a *Action) ValidateArgs() error {
 			}
 		}
 		if !valid {
-			return fmt.Errorf("Action %s is missing argument %s for parameter %s", a.Name, p, a.Params[i])
+			return fmt.Errorf("Action %s is missing argument %s for parameter %s", a.Name, p, a.Params[i].Name)
 		}
 	}
 
 	//Now parse args and ensure
-	args := a.ParseArgs(a.Params)
+	args := a.ParseArgs(a.paramNames())
 	for i := 0; i < 20; i++ { //choosing arbitrary number (20)
 		p := "{" + strconv.Itoa(i) + "}"
 		for _, ar := range args {
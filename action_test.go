@@ -1,9 +1,13 @@
 package slackchatops
 
-import "testing"
+import (
+	"runtime"
+	"testing"
+	"time"
+)
 
 func TestParseArgs(t *testing.T) {
-	action := Action{Name: "Foo", Params: []string{"id", "name"}, Args: []string{"-c", "{0}", "{0} | {1}"}}
+	action := Action{Name: "Foo", Params: []Param{{Name: "id"}, {Name: "name"}}, Args: []string{"-c", "{0}", "{0} | {1}"}}
 	result := action.ParseArgs([]string{"232", "bar"})
 
 	if len(result) != 3 {
@@ -15,7 +19,7 @@ func TestParseArgs(t *testing.T) {
 }
 
 func TestValidateArgs(t *testing.T) {
-	action := Action{Name: "Foo", Params: []string{"id", "name"}, Args: []string{"-c", "{0}", "{0} | {1}"}}
+	action := Action{Name: "Foo", Params: []Param{{Name: "id"}, {Name: "name"}}, Args: []string{"-c", "{0}", "{0} | {1}"}}
 	result := action.ValidateArgs()
 	if result != nil {
 		t.Error(result)
@@ -23,9 +27,25 @@ func TestValidateArgs(t *testing.T) {
 }
 
 func TestValidateArgsWithNotEnoughParams(t *testing.T) {
-	action := Action{Name: "Foo", Params: []string{"id"}, Args: []string{"-c", "{0}", "{0} | {1}"}}
+	action := Action{Name: "Foo", Params: []Param{{Name: "id"}}, Args: []string{"-c", "{0}", "{0} | {1}"}}
 	result := action.ValidateArgs()
 	if result != nil {
 		t.Error(result)
 	}
 }
+
+func TestRunTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	// the background sleep keeps stdout open unless the whole process group is killed
+	action := Action{Name: "Foo", Command: "sh", Args: []string{"-c", "sleep 5 & sleep 5"}, Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	result, _ := action.Run()
+	if !result.TimedOut {
+		t.Error("Expected action to time out")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Child processes were not killed")
+	}
+}
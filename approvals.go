@@ -0,0 +1,218 @@
+package slackchatops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultApprovalTimeout is how long an approval request stays open when none is configured
+const DefaultApprovalTimeout = time.Hour
+
+var (
+	// ErrDenied is returned when an approver denied the request
+	ErrDenied = errors.New("approval denied")
+	// ErrExpired is returned when not enough approvals were given in time
+	ErrExpired = errors.New("approval request expired")
+)
+
+// Approval is a pending request to run an action that needs sign off from other users
+type Approval struct {
+	ID        string
+	Action    *Action
+	Requester string
+	Channel   string
+	Args      []string
+	Requested time.Time
+	Expires   time.Time
+
+	mu         sync.Mutex
+	approvedBy []string
+	deniedBy   string
+	err        error
+	done       chan struct{}
+}
+
+// ApprovedBy returns the users that approved the request so far
+func (a *Approval) ApprovedBy() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.approvedBy...)
+}
+
+// DeniedBy returns the user that denied the request, if any
+func (a *Approval) DeniedBy() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.deniedBy
+}
+
+// Wait blocks until the request is approved (nil), denied (ErrDenied) or expired (ErrExpired)
+func (a *Approval) Wait(ctx context.Context) error {
+	select {
+	case <-a.done:
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *Approval) finish(err error) {
+	a.err = err
+	close(a.done)
+}
+
+// Approvals keeps track of pending approval requests
+type Approvals struct {
+	Timeout time.Duration                        // how long a request stays open. Defaults to DefaultApprovalTimeout
+	Members func(group string) ([]string, error) // resolves a role or group listed in Approvers to its members. Optional
+
+	mu      sync.Mutex
+	pending map[string]*Approval
+}
+
+// NewApprovals creates an empty set of approval requests
+func NewApprovals(timeout time.Duration) *Approvals {
+	if timeout <= 0 {
+		timeout = DefaultApprovalTimeout
+	}
+	return &Approvals{Timeout: timeout, pending: map[string]*Approval{}}
+}
+
+// Request opens a new approval request for the action. It expires after the Timeout
+func (p *Approvals) Request(action *Action, user string, channel string, args []string) *Approval {
+	now := time.Now()
+	approval := &Approval{
+		Action:    action,
+		Requester: user,
+		Channel:   channel,
+		Args:      args,
+		Requested: now,
+		Expires:   now.Add(p.Timeout),
+		done:      make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	for {
+		approval.ID = newJobID()
+		if _, exists := p.pending[approval.ID]; !exists {
+			break
+		}
+	}
+	p.pending[approval.ID] = approval
+	p.mu.Unlock()
+
+	time.AfterFunc(p.Timeout, func() {
+		if p.remove(approval.ID) {
+			approval.mu.Lock()
+			approval.finish(ErrExpired)
+			approval.mu.Unlock()
+		}
+	})
+	return approval
+}
+
+// Approve records the user's approval and reports whether the request now has enough of them.
+// Requesters can't approve their own request and each approver only counts once
+func (p *Approvals) Approve(id string, user string) (*Approval, bool, error) {
+	approval, err := p.checkApprover(id, user)
+	if err != nil {
+		return approval, false, err
+	}
+
+	approval.mu.Lock()
+	defer approval.mu.Unlock()
+	for _, u := range approval.approvedBy {
+		if u == user {
+			return approval, false, fmt.Errorf("You already approved %s", id)
+		}
+	}
+	approval.approvedBy = append(approval.approvedBy, user)
+	if len(approval.approvedBy) < approval.Action.RequiredApprovals() {
+		return approval, false, nil
+	}
+	if !p.remove(id) {
+		return approval, false, fmt.Errorf("No pending approval with id %s", id)
+	}
+	approval.finish(nil)
+	return approval, true, nil
+}
+
+// Deny rejects the request. Any approver may deny it
+func (p *Approvals) Deny(id string, user string) (*Approval, error) {
+	approval, err := p.checkApprover(id, user)
+	if err != nil && approval == nil {
+		return nil, err
+	}
+	// requesters are allowed to withdraw their own request
+	if err != nil && approval.Requester != user {
+		return approval, err
+	}
+	if !p.remove(id) {
+		return approval, fmt.Errorf("No pending approval with id %s", id)
+	}
+	approval.mu.Lock()
+	approval.deniedBy = user
+	approval.finish(ErrDenied)
+	approval.mu.Unlock()
+	return approval, nil
+}
+
+// Pending returns the approval request with the given id
+func (p *Approvals) Pending(id string) (*Approval, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	approval, ok := p.pending[id]
+	return approval, ok
+}
+
+// IsApprover returns true when the user is listed in the action's Approvers, either directly
+// or as a member of one of the listed groups
+func (p *Approvals) IsApprover(action *Action, user string) bool {
+	for _, approver := range action.Approvers {
+		if approver == user {
+			return true
+		}
+		if p.Members == nil {
+			continue
+		}
+		members, err := p.Members(approver)
+		if err != nil {
+			continue
+		}
+		for _, m := range members {
+			if m == user {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Approvals) checkApprover(id string, user string) (*Approval, error) {
+	approval, ok := p.Pending(id)
+	if !ok {
+		return nil, fmt.Errorf("No pending approval with id %s", id)
+	}
+	if approval.Requester == user {
+		return approval, fmt.Errorf("You can't approve your own request")
+	}
+	if !p.IsApprover(approval.Action, user) {
+		return approval, fmt.Errorf("You are not an approver for %s", approval.Action.Name)
+	}
+	return approval, nil
+}
+
+func (p *Approvals) remove(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pending[id]; !ok {
+		return false
+	}
+	delete(p.pending, id)
+	return true
+}
@@ -0,0 +1,62 @@
+package slackchatops
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestApprovalNeedsDistinctApprovers(t *testing.T) {
+	approvals := NewApprovals(time.Minute)
+	action := Action{Name: "deploy", RequiresApproval: true, Approvers: []string{"U1", "U2", "U3"}, MinApprovals: 2}
+	approval := approvals.Request(&action, "U1", "C1", nil)
+
+	if _, _, err := approvals.Approve(approval.ID, "U1"); err == nil {
+		t.Error("Requester should not be able to approve")
+	}
+	if _, _, err := approvals.Approve(approval.ID, "U4"); err == nil {
+		t.Error("Non approver should not be able to approve")
+	}
+	if _, ready, err := approvals.Approve(approval.ID, "U2"); err != nil || ready {
+		t.Error("Expected first approval to be recorded but not be enough")
+	}
+	if _, _, err := approvals.Approve(approval.ID, "U2"); err == nil {
+		t.Error("Approver should only count once")
+	}
+	if _, ready, err := approvals.Approve(approval.ID, "U3"); err != nil || !ready {
+		t.Error("Expected second approval to be enough")
+	}
+	if err := approval.Wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApprovalDenied(t *testing.T) {
+	approvals := NewApprovals(time.Minute)
+	action := Action{Name: "deploy", RequiresApproval: true, Approvers: []string{"S1"}}
+	approvals.Members = func(group string) ([]string, error) { return []string{"U2"}, nil }
+	approval := approvals.Request(&action, "U1", "C1", nil)
+
+	if _, err := approvals.Deny(approval.ID, "U2"); err != nil {
+		t.Error(err)
+	}
+	if err := approval.Wait(context.Background()); err != ErrDenied {
+		t.Error("Expected request to be denied")
+	}
+	if approval.DeniedBy() != "U2" {
+		t.Error("Expected request to be denied by group member U2")
+	}
+}
+
+func TestApprovalExpires(t *testing.T) {
+	approvals := NewApprovals(50 * time.Millisecond)
+	action := Action{Name: "deploy", RequiresApproval: true, Approvers: []string{"U2"}}
+	approval := approvals.Request(&action, "U1", "C1", nil)
+
+	if err := approval.Wait(context.Background()); err != ErrExpired {
+		t.Error("Expected request to expire")
+	}
+	if _, ok := approvals.Pending(approval.ID); ok {
+		t.Error("Expired request is still pending")
+	}
+}
@@ -0,0 +1,210 @@
+package slackchatops
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// What happens to output files once they are uploaded
+const (
+	AfterUploadDelete  = "delete"  // remove them (default) so the next run doesn't upload them again
+	AfterUploadKeep    = "keep"    // leave them where the command wrote them
+	AfterUploadArchive = "archive" // move them to ArchiveDir/<action>-<job>
+)
+
+// DefaultMaxUploadMB is the largest file uploaded when neither the action nor the configuration set MaxUploadMB
+const DefaultMaxUploadMB = 20
+
+// maxUpload returns the size in bytes of the largest file of the action that is uploaded
+func (c *Config) maxUpload(a *Action) int64 {
+	mb := DefaultMaxUploadMB
+	switch {
+	case a.MaxUploadMB > 0:
+		mb = a.MaxUploadMB
+	case c.MaxUploadMB > 0:
+		mb = c.MaxUploadMB
+	}
+	return int64(mb) << 20
+}
+
+// validateOutputFiles checks the patterns and what happens to the files after they are uploaded
+func (a *Action) validateOutputFiles() error {
+	for _, pattern := range a.OutputFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Action %s has invalid output file pattern %s", a.Name, pattern)
+		}
+	}
+	switch a.AfterUpload {
+	case "", AfterUploadDelete, AfterUploadKeep:
+	case AfterUploadArchive:
+		if a.ArchiveDir == "" {
+			return fmt.Errorf("Action %s archives its output files but has no archivedir", a.Name)
+		}
+	default:
+		return fmt.Errorf("Action %s has unknown afterupload %s. Must be one of %s, %s or %s", a.Name, a.AfterUpload, AfterUploadDelete, AfterUploadKeep, AfterUploadArchive)
+	}
+	return nil
+}
+
+// outputFiles returns the files and directories matching OutputFile and OutputFiles. Relative
+// patterns are matched in the action's WorkingDir
+func (a *Action) outputFiles() []string {
+	dir, _ := ExpandPath(a.WorkingDir)
+	patterns := a.OutputFiles
+	if a.OutputFile != "" {
+		patterns = append([]string{a.OutputFile}, patterns...)
+	}
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, pattern := range patterns {
+		pattern, _ = ExpandPath(pattern)
+		if !filepath.IsAbs(pattern) && dir != "" {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// artifact is a file to upload and the output files it was made of
+type artifact struct {
+	path    string
+	sources []string
+}
+
+// uploadOutputFiles uploads the output files the job left behind where the command was requested.
+// Directories are zipped and Bundle zips everything into a single file. Files over the size limit
+// are left in place, the others are deleted, kept or archived as AfterUpload says
+func (b *Bot) uploadOutputFiles(a *Action, job *Job, response Responder) {
+	paths := a.outputFiles()
+	if len(paths) == 0 {
+		return
+	}
+	log := b.Log.WithFields(logrus.Fields{"command": a.Name, "job": job.ID})
+	tmp, err := ioutil.TempDir("", "chatops")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	artifacts := []artifact{}
+	if a.Bundle {
+		artifacts = append(artifacts, artifact{path: filepath.Join(tmp, a.Name+"-"+job.ID+".zip"), sources: paths})
+	} else {
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				artifacts = append(artifacts, artifact{path: filepath.Join(tmp, filepath.Base(path)+".zip"), sources: []string{path}})
+			} else {
+				artifacts = append(artifacts, artifact{path: path, sources: []string{path}})
+			}
+		}
+	}
+
+	limit := b.Config().maxUpload(a)
+	response.Reply("Uploading output files ...")
+	uploaded := []string{}
+	for _, f := range artifacts {
+		if f.path != f.sources[0] {
+			if err := zipFiles(f.path, f.sources); err != nil {
+				log.Error("Unable to zip output files: ", err)
+				continue
+			}
+		}
+		info, err := os.Stat(f.path)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if info.Size() > limit {
+			response.Reply(fmt.Sprintf("*%s is %.1f MB which is over the %d MB upload limit. It was left in %s*",
+				filepath.Base(f.path), float64(info.Size())/(1<<20), limit>>20, filepath.Dir(f.sources[0])))
+			continue
+		}
+		if err := response.Upload(f.path, filepath.Base(f.path)); err != nil {
+			log.WithFields(logrus.Fields{"file": f.path}).Error(err)
+			continue
+		}
+		uploaded = append(uploaded, f.sources...)
+	}
+
+	switch a.AfterUpload {
+	case AfterUploadKeep:
+	case AfterUploadArchive:
+		dir, _ := ExpandPath(a.ArchiveDir)
+		dir = filepath.Join(dir, a.Name+"-"+job.ID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Error("Unable to archive output files: ", err)
+			return
+		}
+		for _, path := range uploaded {
+			if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+				log.WithFields(logrus.Fields{"file": path}).Error("Unable to archive output file: ", err)
+			}
+		}
+	default:
+		for _, path := range uploaded {
+			os.RemoveAll(path)
+		}
+	}
+}
+
+// zipFiles writes the files, and everything in the directories, to a zip archive at dest.
+// Entries are named relative to the parent of each path
+func zipFiles(dest string, paths []string) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	archive := zip.NewWriter(out)
+	for _, root := range paths {
+		base := filepath.Dir(root)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			name, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name, header.Method = filepath.ToSlash(name), zip.Deflate
+			w, err := archive.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,91 @@
+package slackchatops
+
+import (
+	"archive/zip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBotUploadsOutputFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir, _ := ioutil.TempDir("", "artifacts")
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "archive")
+	script := "mkdir -p reports logs && echo a > reports/a.html && echo b > reports/b.html && echo c > reports/c.txt && echo log > logs/run.log && head -c 2000000 /dev/zero > big.bin"
+
+	bot, cleanup := newTestBot(t, &Config{MaxUploadMB: 1, ArchiveDir: archive, Actions: []Action{
+		{Name: "report", Command: "sh", Args: []string{"-c", script}, WorkingDir: dir, OutputFiles: []string{"reports/*.html", "logs", "big.bin"}},
+		{Name: "bundle", Command: "sh", Args: []string{"-c", script}, WorkingDir: dir, OutputFiles: []string{"reports/*.html", "logs"}, Bundle: true, AfterUpload: AfterUploadArchive},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "report"}, response)
+	uploads := strings.Join(response.uploads, "\n")
+	if len(response.uploads) != 3 || !strings.Contains(uploads, "a.html: a") || !strings.Contains(uploads, "b.html: b") || !strings.Contains(uploads, "logs.zip: ") {
+		t.Errorf("expected both reports and the zipped logs but got %v", response.uploads)
+	}
+	if text := response.text(); !strings.Contains(text, "big.bin is 1.9 MB which is over the 1 MB upload limit") {
+		t.Errorf("expected big.bin to be over the limit but got %s", text)
+	}
+	for path, exists := range map[string]bool{"reports/a.html": false, "logs": false, "reports/c.txt": true, "big.bin": true} {
+		if _, err := os.Stat(filepath.Join(dir, path)); (err == nil) != exists {
+			t.Errorf("expected %s to exist: %v", path, exists)
+		}
+	}
+
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "bundle"}, response)
+	if len(response.uploads) != 1 || !strings.HasPrefix(response.uploads[0], "bundle-") {
+		t.Fatalf("expected a single bundle but got %v", response.uploads)
+	}
+	archived, _ := filepath.Glob(filepath.Join(archive, "bundle-*", "*"))
+	if len(archived) != 3 {
+		t.Errorf("expected the reports and logs to be archived but got %v", archived)
+	}
+}
+
+func TestZipFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "zip")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "logs", "nested"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "logs", "nested", "a.log"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "report.html"), []byte("r"), 0644)
+
+	dest := filepath.Join(dir, "out.zip")
+	if err := zipFiles(dest, []string{filepath.Join(dir, "logs"), filepath.Join(dir, "report.html")}); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	names := []string{}
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "logs/nested/a.log,report.html" {
+		t.Errorf("unexpected entries %v", names)
+	}
+}
+
+func TestActionValidatesOutputFiles(t *testing.T) {
+	tests := map[string]Action{
+		"invalid output file pattern": {Name: "a", Command: "true", OutputFiles: []string{"reports/[.html"}},
+		"unknown afterupload":         {Name: "a", Command: "true", AfterUpload: "shred"},
+		"has no archivedir":           {Name: "a", Command: "true", AfterUpload: AfterUploadArchive},
+	}
+	for expected, a := range tests {
+		if err := a.Validate(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q but got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,501 @@
+package slackchatops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shomali11/commander"
+	"github.com/shomali11/proper"
+	logrus "github.com/sirupsen/logrus"
+)
+
+const configPollInterval = 2 * time.Second
+
+// DefaultHistoryFile is used when the configuration doesn't set a HistoryFile
+const DefaultHistoryFile = "history.jsonl"
+
+// Command is something the bot responds to. Usage is written like `cancel <id>`
+// where words in angle brackets are parameters
+type Command struct {
+	Usage       string
+	Description string
+	Admin       bool // admin commands are also accepted in the AdminChannel
+
+	matcher *commander.Command
+	handler func(request *Request, response Responder)
+}
+
+// NewCommand creates a command calling handler whenever a message matches usage
+func NewCommand(usage string, description string, handler func(request *Request, response Responder)) *Command {
+	return &Command{Usage: usage, Description: description, matcher: commander.NewCommand(usage), handler: handler}
+}
+
+// Tokenize returns the words of the command's usage
+func (c *Command) Tokenize() []*commander.Token {
+	return c.matcher.Tokenize()
+}
+
+// Request is a Message that matched a Command
+type Request struct {
+	Message
+	ctx    context.Context
+	params *proper.Properties
+	system bool // started by a schedule or trigger which skip permission checks
+}
+
+// Context is cancelled when the bot shuts down
+func (r *Request) Context() context.Context {
+	return r.ctx
+}
+
+// Param returns the value of a parameter in the command's usage or an empty string
+func (r *Request) Param(name string) string {
+	return r.params.StringParam(name, "")
+}
+
+// IntParam returns the value of a parameter as a number or defaultValue when it isn't one
+func (r *Request) IntParam(name string, defaultValue int) int {
+	if n, err := strconv.Atoi(r.Param(name)); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+// setup is everything built from the configuration. It is replaced as a whole on reload
+type setup struct {
+	config      *Config
+	permissions *Permissions
+	commands    []*Command
+	runnables   map[string]*runnable
+	masker      *masker // hides every value read from the environment, files or secrets
+}
+
+// Bot dispatches messages to actions and built in commands. It doesn't know which chat
+// service it is connected to: frontends turn their events into a Message and pass a
+// Responder to Handle
+type Bot struct {
+	Jobs          *Jobs
+	Locks         *Locks
+	History       *History
+	Approvals     *Approvals
+	Confirmations *Confirmations
+	Schedules     *Schedules
+	Log           *logrus.Entry
+	GroupMembers  func(handle string) ([]string, error)                 // resolves chat user group handles used in roles. Optional
+	Notify        func(channel string, text string) error               // posts to a channel outside of a reply (ex: AdminChannel). Optional
+	OpenForm      func(trigger string, a *Action, channel string) error // shows a form for the action's params (ex: a Slack modal). Optional
+	Responder     func(channel string) Responder                        // replies in a channel without a message to answer (ex: scheduled runs). Optional
+
+	path     string
+	mask     *maskHook
+	mu       sync.RWMutex
+	setup    *setup
+	mod      time.Time
+	builtins []*Command
+}
+
+// NewBot validates the configuration read from path and creates a bot for it
+func NewBot(path string, config *Config, log *logrus.Entry) (*Bot, error) {
+	if config.HistoryFile == "" {
+		config.HistoryFile = DefaultHistoryFile
+	}
+	historyFile, _ := ExpandPath(config.HistoryFile)
+	history, err := OpenHistory(historyFile, config.HistoryMaxAge, config.HistoryMaxRuns)
+	if err != nil {
+		return nil, err
+	}
+	if config.ScheduleFile == "" {
+		config.ScheduleFile = DefaultScheduleFile
+	}
+	scheduleFile, _ := ExpandPath(config.ScheduleFile)
+	schedules, err := OpenSchedules(scheduleFile)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bot{
+		Jobs:          NewJobs(),
+		Locks:         NewLocks(),
+		History:       history,
+		Approvals:     NewApprovals(config.ApprovalTimeout),
+		Confirmations: NewConfirmations(config.ConfirmTimeout),
+		Schedules:     schedules,
+		Log:           log,
+		path:          path,
+		mask:          &maskHook{},
+	}
+	log.Logger.AddHook(b.mask)
+	b.Jobs.Used = func(id string) bool {
+		_, ok := history.Get(id)
+		return ok
+	}
+	b.Approvals.Members = func(name string) ([]string, error) {
+		return b.Permissions().Members(name)
+	}
+	if err := b.Load(config); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		b.mod = info.ModTime()
+	}
+
+	b.Command("help <action>", "List the actions you can run here or show the details of one", b.helpHandler)
+	b.Command("run <action>", "Enter the parameters of an action in a form", b.runHandler)
+	b.Command("cancel <id>", "Cancel a running job", b.cancelHandler)
+	b.Command("yes <token>", "Confirm running an action", b.yesHandler)
+	b.Command("no <token>", "Cancel an action waiting for confirmation", b.noHandler)
+	b.Command("approve <id>", "Approve a pending action request", b.approveHandler)
+	b.Command("deny <id>", "Deny a pending action request", b.denyHandler)
+	b.Command("history <action> <n>", "List the latest runs, optionally only for one action", b.historyHandler)
+	b.Command("show <id>", "Show the output of a previous run", b.showHandler)
+	b.Command("schedules", "List the scheduled actions and when they run next", b.schedulesHandler)
+	b.Command("pause <schedule>", "Stop a schedule from running until it is resumed", b.pauseHandler)
+	b.Command("resume <schedule>", "Resume a paused schedule", b.resumeHandler)
+	b.Command("whoami", "Show your roles and the actions you can run here", b.whoamiHandler)
+	b.Command("can <action>", "Explain whether you can run an action here", b.canHandler)
+	reload := b.Command("reload", "Reload the configuration (admins only)", b.reloadHandler)
+	reload.Admin = true
+	return b, nil
+}
+
+// Command registers a built in command. Built in commands take precedence over actions
+func (b *Bot) Command(usage string, description string, handler func(request *Request, response Responder)) *Command {
+	command := NewCommand(usage, description, handler)
+	b.mu.Lock()
+	b.builtins = append(b.builtins, command)
+	b.mu.Unlock()
+	return command
+}
+
+// Load validates every action of the configuration and builds commands for them. The
+// active configuration is only replaced when the whole new one is valid
+func (b *Bot) Load(config *Config) error {
+	permissions := NewPermissions(config.Roles)
+	permissions.GroupMembers = func(handle string) ([]string, error) {
+		if b.GroupMembers == nil {
+			return nil, fmt.Errorf("User group @%s can't be resolved", handle)
+		}
+		return b.GroupMembers(handle)
+	}
+	s := &setup{config: config, permissions: permissions, runnables: map[string]*runnable{}}
+
+	environment := &environment{config: config}
+	global, globalHidden, err := environment.resolve(config.Env)
+	if err != nil {
+		return err
+	}
+	// resolve sets the env of an action or workflow, the action's own values winning over the global ones
+	resolve := func(a *Action) error {
+		vars, hidden, err := environment.resolve(a.Env)
+		if err != nil {
+			return fmt.Errorf("Action %s: %v", a.Name, err)
+		}
+		a.env = append(append([]string{}, global...), vars...)
+		a.masker = newMasker(append(append([]string{}, globalHidden...), hidden...))
+		return nil
+	}
+
+	for i := range config.Actions {
+		a := &config.Actions[i]
+		if a.Timeout == 0 {
+			a.Timeout = config.Timeout
+		}
+		if a.Replies == "" {
+			a.Replies = config.Replies
+		}
+		if a.ArchiveDir == "" {
+			a.ArchiveDir = config.ArchiveDir
+		}
+		err := a.Validate()
+		if err == nil {
+			err = permissions.Validate(a)
+		}
+		if err == nil {
+			err = resolve(a)
+		}
+		if err != nil {
+			return err
+		}
+
+		s.add(&runnable{action: *a, execute: b.commandExecutor(*a, config)}, b)
+	}
+	for i := range config.Workflows {
+		w := &config.Workflows[i]
+		if w.Replies == "" {
+			w.Replies = config.Replies
+		}
+		if _, exists := s.runnables[w.Name]; exists {
+			return fmt.Errorf("Workflow %s has the same name as another action or workflow", w.Name)
+		}
+		err := w.Validate(config)
+		if err == nil {
+			err = permissions.Validate(&w.Action)
+		}
+		if err == nil {
+			err = resolve(&w.Action)
+		}
+		if err != nil {
+			return err
+		}
+		s.add(&runnable{action: w.Action, execute: b.workflowExecutor(*w, config)}, b)
+	}
+	find := func(name string) *Action {
+		if r, ok := s.runnables[name]; ok {
+			return &r.action
+		}
+		return nil
+	}
+	names := map[string]bool{}
+	for i := range config.Schedules {
+		schedule := &config.Schedules[i]
+		if names[schedule.Name] {
+			return fmt.Errorf("Schedule %s is defined more than once", schedule.Name)
+		}
+		names[schedule.Name] = true
+		if err := schedule.Validate(config, find); err != nil {
+			return err
+		}
+	}
+	names = map[string]bool{}
+	for i := range config.Triggers {
+		trigger := &config.Triggers[i]
+		if names[trigger.Name] {
+			return fmt.Errorf("Trigger %s is defined more than once", trigger.Name)
+		}
+		names[trigger.Name] = true
+		if err := trigger.Validate(config, find); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range environment.short {
+		b.Log.WithFields(logrus.Fields{"env": name}).Warn("EnvTooShortToMask")
+	}
+	s.masker = newMasker(environment.hidden)
+	b.mu.Lock()
+	b.setup = s
+	b.mu.Unlock()
+	b.mask.set(s.masker)
+	return nil
+}
+
+// add registers the command running an action or workflow
+func (s *setup) add(r *runnable, b *Bot) {
+	a := r.action
+	description := a.Description
+	if description == "" {
+		description = a.Name
+	}
+	params := ""
+	for _, p := range a.Params {
+		params += " <" + p.Name + ">"
+	}
+	s.runnables[a.Name] = r
+	s.commands = append(s.commands, NewCommand(a.Name+params, description, b.actionHandler(r, s)))
+}
+
+// FindAction returns the action, or the action describing a workflow, with the given name or nil when there isn't one
+func (b *Bot) FindAction(name string) *Action {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if r, ok := b.setup.runnables[name]; ok {
+		a := r.action
+		return &a
+	}
+	return nil
+}
+
+// Config returns the active configuration
+func (b *Bot) Config() *Config {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.setup.config
+}
+
+// Permissions returns the permissions of the active configuration
+func (b *Bot) Permissions() *Permissions {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.setup.permissions
+}
+
+// Commands returns every command the bot responds to: help, the actions and then the other built in commands
+func (b *Bot) Commands() []*Command {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result := []*Command{}
+	result = append(result, b.builtins[:1]...)
+	result = append(result, b.setup.commands...)
+	return append(result, b.builtins[1:]...)
+}
+
+// Handle dispatches a message to the first built in command or action whose keyword is the first
+// word of the message. Messages outside of the configured channel are ignored unless they are slash commands
+func (b *Bot) Handle(ctx context.Context, message Message, response Responder) {
+	b.mu.RLock()
+	config := b.setup.config
+	commands := append(append([]*Command{}, b.builtins...), b.setup.commands...)
+	b.mu.RUnlock()
+
+	word := commandWord(message.Text)
+	for _, command := range commands {
+		// commander matches its keyword anywhere in the text so arguments such as `make run`
+		// would otherwise be taken for the run command
+		if !strings.EqualFold(command.Tokenize()[0].Word, word) {
+			continue
+		}
+		params, ok := command.matcher.Match(message.Text)
+		if !ok {
+			continue
+		}
+		if !message.Slash && !listensOn(config, message.Channel, command.Admin) {
+			return
+		}
+		b.Log.WithFields(logrus.Fields{"command": command.Usage, "channel": message.Channel, "user": message.User}).Debug("Handle")
+		command.handler(&Request{Message: message, ctx: ctx, params: params}, response)
+		return
+	}
+
+	if message.Slash || listensOn(config, message.Channel, false) {
+		response.Alert(AlertWarning, "Unknown action", "")
+	}
+}
+
+// commandWord returns the first word of the text after any mention of the bot
+func commandWord(text string) string {
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "<@") {
+			return word
+		}
+	}
+	return ""
+}
+
+// Reload reads the configuration file again and swaps it in if every action is valid.
+// When anything is wrong the previous configuration stays active
+func (b *Bot) Reload() error {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return err
+	}
+	config, err := ReadConfig(b.path)
+	if err != nil {
+		return err
+	}
+	old := b.Config()
+	if config.HistoryFile == "" {
+		config.HistoryFile = old.HistoryFile
+	}
+	if config.ScheduleFile == "" {
+		config.ScheduleFile = old.ScheduleFile
+	}
+	if err := b.Load(config); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.mod = info.ModTime()
+	b.mu.Unlock()
+
+	for _, setting := range restartRequired(old, config) {
+		b.Log.WithFields(logrus.Fields{"setting": setting}).Warn("ReloadIgnoredSetting")
+	}
+	b.Log.WithFields(logrus.Fields{"actions": len(config.Actions)}).Info("ConfigReloaded")
+	return nil
+}
+
+// Watch reloads the configuration whenever the file changes or reload receives a value
+// (ex: SIGHUP) until the context is done
+func (b *Bot) Watch(ctx context.Context, reload <-chan os.Signal) {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-reload:
+			b.reportReload(sig.String())
+		case <-ticker.C:
+			info, err := os.Stat(b.path)
+			b.mu.RLock()
+			changed := err == nil && !info.ModTime().Equal(b.mod)
+			b.mu.RUnlock()
+			if changed {
+				b.reportReload("file change")
+			}
+		}
+	}
+}
+
+// reportReload reloads and sends any validation error to the log and the admin channel
+func (b *Bot) reportReload(trigger string) error {
+	err := b.Reload()
+	if err == nil {
+		return nil
+	}
+	if info, serr := os.Stat(b.path); serr == nil {
+		// don't report the same broken file again on the next poll
+		b.mu.Lock()
+		b.mod = info.ModTime()
+		b.mu.Unlock()
+	}
+	b.Log.WithFields(logrus.Fields{"trigger": trigger}).Error("Config reload failed, keeping previous config: ", err)
+	if config := b.Config(); config.AdminChannel != "" && b.Notify != nil {
+		b.Notify(config.AdminChannel, fmt.Sprintf("*Config reload failed (%s), keeping previous config:*\n%s", trigger, err))
+	}
+	return err
+}
+
+// restartRequired lists settings that changed but are only read at startup
+func restartRequired(old *Config, new *Config) []string {
+	changed := []string{}
+	if old.SlackToken != new.SlackToken {
+		changed = append(changed, "slacktoken")
+	}
+	if old.Transport != new.Transport || old.SigningSecret != new.SigningSecret || old.AppToken != new.AppToken || old.ListenAddress != new.ListenAddress || old.SlackAPIURL != new.SlackAPIURL {
+		changed = append(changed, "transport")
+	}
+	// the HTTP server only listens when something needed it at startup
+	if len(old.Triggers) == 0 && len(new.Triggers) > 0 && old.SigningSecret == "" && old.Transport != TransportEvents {
+		changed = append(changed, "triggers")
+	}
+	if old.HistoryFile != new.HistoryFile {
+		changed = append(changed, "historyfile")
+	}
+	if old.ScheduleFile != new.ScheduleFile {
+		changed = append(changed, "schedulefile")
+	}
+	if old.ApprovalTimeout != new.ApprovalTimeout {
+		changed = append(changed, "approvaltimeout")
+	}
+	if old.ConfirmTimeout != new.ConfirmTimeout {
+		changed = append(changed, "confirmtimeout")
+	}
+	return changed
+}
+
+// isAdmin returns true when the user is listed in Admins directly or through a role
+func (b *Bot) isAdmin(user string) bool {
+	config, permissions := b.Config(), b.Permissions()
+	for _, admin := range config.Admins {
+		if admin == user {
+			return true
+		}
+		if members, err := permissions.Members(admin); err == nil && contains(members, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// listensOn returns true when the bot should respond in the channel
+func listensOn(config *Config, channel string, admin bool) bool {
+	if config.SlackChannel == "" || config.SlackChannel == channel {
+		return true
+	}
+	return admin && config.AdminChannel == channel
+}
@@ -0,0 +1,290 @@
+package slackchatops
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeResponder records everything the bot sends back
+type fakeResponder struct {
+	mu      sync.Mutex
+	replies []string
+	alerts  []string
+	edits   []string
+	uploads []string
+
+	threads   bool           // replies to Thread go to thread instead of the responder itself
+	thread    *fakeResponder // replies posted in the thread
+	reactions []string       // reactions currently on the message
+	parent    *fakeResponder // responder of the message a thread was started from
+}
+
+func (r *fakeResponder) Reply(text string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replies = append(r.replies, text)
+	return "", nil
+}
+
+func (r *fakeResponder) Alert(color string, title string, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, color+": "+title)
+	return nil
+}
+
+func (r *fakeResponder) Buttons(text string, buttons []Button) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, button := range buttons {
+		text += " [" + button.Label + ": " + button.Command + "]"
+	}
+	r.replies = append(r.replies, text)
+	return nil
+}
+
+func (r *fakeResponder) Fields(color string, text string, fields []Field) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, field := range fields {
+		text += "\n" + field.Title + ": " + field.Value
+	}
+	r.replies = append(r.replies, text)
+	return nil
+}
+
+func (r *fakeResponder) Edit(id string, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.edits = append(r.edits, text)
+	return nil
+}
+
+// lastEdit returns the latest version of the edited message
+func (r *fakeResponder) lastEdit() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.edits) == 0 {
+		return ""
+	}
+	return r.edits[len(r.edits)-1]
+}
+
+func (r *fakeResponder) Upload(path string, title string) error {
+	content, err := ioutil.ReadFile(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uploads = append(r.uploads, title+": "+string(content))
+	return err
+}
+
+func (r *fakeResponder) Typing() {}
+
+func (r *fakeResponder) Thread() Responder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.threads {
+		return r
+	}
+	if r.thread == nil {
+		r.thread = &fakeResponder{parent: r}
+	}
+	return r.thread
+}
+
+func (r *fakeResponder) React(emoji string) error {
+	if r.parent != nil {
+		return r.parent.React(emoji)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reactions = append(r.reactions, emoji)
+	return nil
+}
+
+func (r *fakeResponder) Unreact(emoji string) error {
+	if r.parent != nil {
+		return r.parent.Unreact(emoji)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, reaction := range r.reactions {
+		if reaction == emoji {
+			r.reactions = append(r.reactions[:i], r.reactions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *fakeResponder) text() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(append(r.alerts, r.replies...), "\n")
+}
+
+func newTestBot(t *testing.T, config *Config) (*Bot, func()) {
+	dir, _ := ioutil.TempDir("", "bot")
+	path := filepath.Join(dir, "config.yaml")
+	config.HistoryFile = filepath.Join(dir, "history.jsonl")
+	config.ScheduleFile = filepath.Join(dir, "schedules.json")
+	if err := config.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	bot, err := NewBot(path, config, NewLogger("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, func() { os.RemoveAll(dir) }
+}
+
+func TestBotRunsAction(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "greet", Command: "sh", Args: []string{"-c", "echo hello {0}"}, Params: []Param{{Name: "name"}}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "greet world"}, response)
+	if text := response.text(); !strings.Contains(text, "ExitCode: 0") || !strings.Contains(text, "hello world") {
+		t.Errorf("unexpected replies: %s", text)
+	}
+	if runs := bot.History.Recent("greet", 1); len(runs) != 1 || runs[0].User != "U1" {
+		t.Errorf("expected run to be recorded but got %+v", runs)
+	}
+}
+
+func TestBotUnknownAndUnauthorized(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "drop", Command: "true", AuthorizedUsers: []string{"U1"}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U2", Channel: "C1", Text: "nope"}, response)
+	bot.Handle(context.Background(), Message{User: "U2", Channel: "C1", Text: "drop"}, response)
+	if len(response.alerts) != 2 || response.alerts[0] != "warning: Unknown action" || !strings.HasPrefix(response.alerts[1], "danger: You are not authorized") {
+		t.Errorf("unexpected alerts: %v", response.alerts)
+	}
+}
+
+func TestBotIgnoresOtherChannels(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{SlackChannel: "C1", AdminChannel: "CADMIN", Admins: []string{"U1"}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C2", Text: "help"}, response)
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "CADMIN", Text: "whoami"}, response)
+	if text := response.text(); text != "" {
+		t.Errorf("expected no replies outside of C1 but got %s", text)
+	}
+
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "CADMIN", Text: "reload"}, response)
+	if text := response.text(); !strings.Contains(text, "Configuration reloaded") {
+		t.Errorf("expected reload in the admin channel but got %s", text)
+	}
+}
+
+func TestBotHelpListsActionsAndBuiltins(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "deploy", Command: "echo", Args: []string{"{0}"}, Description: "Deploy it", Params: []Param{{Name: "version"}}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "help"}, response)
+	text := response.text()
+	for _, expected := range []string{"• `deploy <version>` - Deploy it", "`cancel <id>`", "`reload`"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected help to contain %s but got %s", expected, text)
+		}
+	}
+}
+
+func TestBotRepliesInThread(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "greet", Command: "sh", Args: []string{"-c", "echo hello {0}"}, Params: []Param{{Name: "name"}}},
+		{Name: "fail", Command: "sh", Args: []string{"-c", "exit 2"}, Replies: RepliesQuiet},
+		{Name: "loud", Command: "echo", Replies: RepliesChannel, NoReactions: true},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{threads: true}
+	bot.Handle(context.Background(), Message{ID: "1.1", User: "U1", Channel: "C1", Text: "greet world"}, response)
+	if text := response.thread.text(); !strings.Contains(text, "ExitCode: 0") || !strings.Contains(text, "hello world") {
+		t.Errorf("expected result in the thread but got %s", text)
+	}
+	if text := response.text(); !strings.HasPrefix(text, ":white_check_mark: `greet world` by <@U1> succeeded after") || strings.Contains(text, "hello world") {
+		t.Errorf("expected only a summary in the channel but got %s", text)
+	}
+	if len(response.reactions) != 1 || response.reactions[0] != ReactionSucceeded {
+		t.Errorf("expected succeeded reaction but got %v", response.reactions)
+	}
+
+	response = &fakeResponder{threads: true}
+	bot.Handle(context.Background(), Message{ID: "1.2", User: "U1", Channel: "C1", Text: "fail"}, response)
+	if text := response.text(); text != "" {
+		t.Errorf("expected no summary for quiet replies but got %s", text)
+	}
+	if len(response.reactions) != 1 || response.reactions[0] != ReactionFailed {
+		t.Errorf("expected failed reaction but got %v", response.reactions)
+	}
+
+	response = &fakeResponder{threads: true}
+	bot.Handle(context.Background(), Message{ID: "1.3", User: "U1", Channel: "C1", Text: "loud"}, response)
+	if response.thread != nil || !strings.Contains(response.text(), "ExitCode: 0") || len(response.reactions) != 0 {
+		t.Errorf("expected replies in the channel without reactions but got %s %v", response.text(), response.reactions)
+	}
+}
+
+func TestBotCancelByAuthorizedUser(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "sleep", Command: "sleep", Args: []string{"60"}},
+		{Name: "drop", Command: "true", AuthorizedUsers: []string{"U1"}},
+	}})
+	defer cleanup()
+
+	open, _ := bot.Jobs.Start(context.Background(), bot.FindAction("sleep"), "U1", "C1")
+	restricted, _ := bot.Jobs.Start(context.Background(), bot.FindAction("drop"), "U1", "C1")
+	defer bot.Jobs.Finish(open)
+	defer bot.Jobs.Finish(restricted)
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U2", Channel: "C1", Text: "cancel " + open.ID}, response)
+	if text := response.text(); !strings.Contains(text, "Cancelling job") {
+		t.Errorf("expected anyone to cancel an unrestricted job but got %s", text)
+	}
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U2", Channel: "C1", Text: "cancel " + restricted.ID}, response)
+	if text := response.text(); !strings.Contains(text, "not authorized to cancel") {
+		t.Errorf("expected U2 to be refused but got %s", text)
+	}
+}
+
+func TestBotArgumentsDontMatchBuiltins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "make", Command: "sh", Args: []string{"-c", "echo making {0}"}, Params: []Param{{Name: "target"}}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "<@UBOT> make run"}, response)
+	if text := response.text(); !strings.Contains(text, "making run") {
+		t.Errorf("expected make to run with the argument run but got %s", text)
+	}
+}
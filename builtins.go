@@ -0,0 +1,298 @@
+package slackchatops
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHistoryCount = 10
+	timeFormat          = "2006-01-02 15:04:05"
+)
+
+// runHandler opens a form for the action's params when the frontend can show one. Otherwise
+// it shows the usage with a button that opens the form once clicked
+func (b *Bot) runHandler(request *Request, response Responder) {
+	name := strings.TrimSpace(request.Param("action"))
+	a := b.FindAction(name)
+	if a == nil {
+		reportError(response, fmt.Errorf("Unknown action %s", name))
+		return
+	}
+	if !b.Permissions().Check(a, request.User, request.Channel).Allowed {
+		response.Alert(AlertDanger, "You are not authorized to execute this action", "")
+		return
+	}
+	if len(a.Params) == 0 {
+		response.Buttons(fmt.Sprintf("`%s` has no parameters", a.Name), []Button{{Label: "Run " + a.Name, Command: a.Name, Style: "primary"}})
+		return
+	}
+	if request.Trigger != "" && b.OpenForm != nil {
+		err := b.OpenForm(request.Trigger, a, request.Channel)
+		if err == nil {
+			return
+		}
+		b.Log.WithFields(logrus.Fields{"command": a.Name}).Warn("Unable to open form: ", err)
+	}
+
+	usage := a.Name
+	for _, p := range a.Params {
+		usage += " <" + p.Name + ">"
+	}
+	response.Buttons(fmt.Sprintf("Usage: `%s`", usage), []Button{{Label: "Enter parameters", Command: "run " + a.Name}})
+}
+
+// cancelHandler stops a running job. Only the user that started the job or a user
+// authorized for the job's action may cancel it
+func (b *Bot) cancelHandler(request *Request, response Responder) {
+	id := strings.TrimSpace(request.Param("id"))
+	user := request.User
+	job, ok := b.Jobs.Get(id)
+	if !ok {
+		reportError(response, fmt.Errorf("No running job with id %s", id))
+		return
+	}
+	if job.User != user && !b.Permissions().Check(job.Action, user, request.Channel).Allowed {
+		response.Alert(AlertDanger, "You are not authorized to cancel this job", "")
+		return
+	}
+
+	if err := b.Jobs.Cancel(id, user); err != nil {
+		reportError(response, err)
+		return
+	}
+	b.Log.WithFields(logrus.Fields{"command": job.Action.Name, "job": id, "user": user}).Info("JobCancelled")
+	response.Reply(fmt.Sprintf("Cancelling job `%s`...", id))
+}
+
+// yesHandler confirms an action waiting for confirmation
+func (b *Bot) yesHandler(request *Request, response Responder) {
+	if err := b.Confirmations.Confirm(strings.TrimSpace(request.Param("token")), request.User); err != nil {
+		reportError(response, err)
+	}
+}
+
+// noHandler cancels an action waiting for confirmation
+func (b *Bot) noHandler(request *Request, response Responder) {
+	if err := b.Confirmations.Decline(strings.TrimSpace(request.Param("token")), request.User); err != nil {
+		reportError(response, err)
+	}
+}
+
+// approveHandler records an approval for a pending request
+func (b *Bot) approveHandler(request *Request, response Responder) {
+	id := strings.TrimSpace(request.Param("id"))
+	approval, ready, err := b.Approvals.Approve(id, request.User)
+	if err != nil {
+		reportError(response, err)
+		return
+	}
+	b.Log.WithFields(logrus.Fields{"approval": id, "user": request.User}).Info("ApprovalRecorded")
+	if !ready {
+		response.Reply(fmt.Sprintf("Approval recorded for `%s` (%d of %d)", id, len(approval.ApprovedBy()), approval.Action.RequiredApprovals()))
+	}
+}
+
+// denyHandler rejects a pending request. Requesters can also use it to withdraw their own request
+func (b *Bot) denyHandler(request *Request, response Responder) {
+	id := strings.TrimSpace(request.Param("id"))
+	if _, err := b.Approvals.Deny(id, request.User); err != nil {
+		reportError(response, err)
+		return
+	}
+	b.Log.WithFields(logrus.Fields{"approval": id, "user": request.User}).Info("ApprovalDenied")
+}
+
+// historyHandler lists the latest runs. Both the action and the number of runs are optional
+// so `history`, `history 5`, `history deploy` and `history deploy 5` all work
+func (b *Bot) historyHandler(request *Request, response Responder) {
+	action := strings.TrimSpace(request.Param("action"))
+	count := request.IntParam("n", defaultHistoryCount)
+	if n, err := strconv.Atoi(action); err == nil {
+		action, count = "", n
+	}
+
+	runs := b.History.Recent(action, count)
+	if len(runs) == 0 {
+		response.Reply("_No runs recorded_")
+		return
+	}
+	message := ""
+	for _, run := range runs {
+		message += fmt.Sprintf("`%s` *%s* by %s at %s - %s (%s)\n", run.ID, run.Action, mentions([]string{run.User}), run.Started.Format(timeFormat), runStatus(run), run.Duration().Round(time.Second))
+	}
+	response.Reply(message)
+}
+
+// showHandler replies with the full output of a previous run. Output of restricted actions is
+// only shown to users authorized for that action
+func (b *Bot) showHandler(request *Request, response Responder) {
+	id := strings.TrimSpace(request.Param("id"))
+	run, ok := b.History.Get(id)
+	if !ok {
+		reportError(response, fmt.Errorf("No run with id %s", id))
+		return
+	}
+	if a := b.FindAction(run.Action); a != nil && !b.Permissions().Check(a, request.User, request.Channel).Allowed {
+		reportError(response, fmt.Errorf("You are not authorized to view runs of %s", run.Action))
+		return
+	}
+
+	message := fmt.Sprintf("`%s` *%s %s* by %s\n", run.ID, run.Action, strings.Join(run.Args, " "), mentions([]string{run.User}))
+	message += fmt.Sprintf("Started %s, took %s\n", run.Started.Format(timeFormat), run.Duration().Round(time.Second))
+	message += "*" + runStatus(run) + "*"
+	response.Reply(message)
+	b.replyOutput(b.FindAction(run.Action), run, true, response)
+}
+
+// schedulesHandler lists every schedule with its next run and whether it is paused
+func (b *Bot) schedulesHandler(request *Request, response Responder) {
+	config := b.Config()
+	if len(config.Schedules) == 0 {
+		response.Reply("_No schedules configured_")
+		return
+	}
+	now := time.Now()
+	message := ""
+	for i := range config.Schedules {
+		schedule := &config.Schedules[i]
+		message += fmt.Sprintf("*%s* `%s` runs `%s` in <#%s>", schedule.Name, schedule.Cron, strings.TrimSpace(schedule.Action+" "+strings.Join(schedule.Args, " ")), schedule.channel(config))
+		last, paused, pausedBy := b.Schedules.Status(schedule.Name)
+		switch next := schedule.Next(now); {
+		case paused:
+			message += fmt.Sprintf(" - _paused by %s_", mentions([]string{pausedBy}))
+		case next.IsZero():
+			message += " - never runs"
+		default:
+			message += " - next " + next.Format(timeFormat+" MST")
+		}
+		if !last.IsZero() {
+			message += fmt.Sprintf(" (last due %s)", last.In(schedule.location).Format(timeFormat+" MST"))
+		}
+		message += "\n"
+	}
+	response.Reply(message)
+}
+
+// pauseHandler stops a schedule from running. Admins and users allowed to run the scheduled action can pause it
+func (b *Bot) pauseHandler(request *Request, response Responder) {
+	schedule, err := b.manageSchedule(request)
+	if err == nil {
+		err = b.Schedules.Pause(schedule.Name, request.User)
+	}
+	if err != nil {
+		reportError(response, err)
+		return
+	}
+	b.Log.WithFields(logrus.Fields{"schedule": schedule.Name, "user": request.User}).Info("SchedulePaused")
+	response.Reply(fmt.Sprintf("Schedule `%s` paused. Use `resume %s` to run it again", schedule.Name, schedule.Name))
+}
+
+// resumeHandler lets a paused schedule run again
+func (b *Bot) resumeHandler(request *Request, response Responder) {
+	schedule, err := b.manageSchedule(request)
+	if err == nil {
+		err = b.Schedules.Resume(schedule.Name, time.Now())
+	}
+	if err != nil {
+		reportError(response, err)
+		return
+	}
+	b.Log.WithFields(logrus.Fields{"schedule": schedule.Name, "user": request.User}).Info("ScheduleResumed")
+	response.Reply(fmt.Sprintf("Schedule `%s` resumed, next run %s", schedule.Name, schedule.Next(time.Now()).Format(timeFormat+" MST")))
+}
+
+// manageSchedule returns the schedule named in the request if the user may pause or resume it
+func (b *Bot) manageSchedule(request *Request) (*Schedule, error) {
+	name := strings.TrimSpace(request.Param("schedule"))
+	config := b.Config()
+	for i := range config.Schedules {
+		schedule := &config.Schedules[i]
+		if schedule.Name != name {
+			continue
+		}
+		a := b.FindAction(schedule.Action)
+		if !b.isAdmin(request.User) && (a == nil || !b.Permissions().Check(a, request.User, request.Channel).Allowed) {
+			return nil, fmt.Errorf("You are not authorized to manage schedule %s", name)
+		}
+		return schedule, nil
+	}
+	return nil, fmt.Errorf("Unknown schedule %s", name)
+}
+
+// whoamiHandler shows the user's roles and the actions they may run in the current channel
+func (b *Bot) whoamiHandler(request *Request, response Responder) {
+	config, permissions := b.Config(), b.Permissions()
+	user := request.User
+	roles := permissions.RolesOf(user)
+	actions := []string{}
+	for i := range config.Actions {
+		a := &config.Actions[i]
+		if permissions.Check(a, user, request.Channel).Allowed {
+			actions = append(actions, "`"+a.Name+"`")
+		}
+	}
+	for i := range config.Workflows {
+		a := &config.Workflows[i].Action
+		if permissions.Check(a, user, request.Channel).Allowed {
+			actions = append(actions, "`"+a.Name+"`")
+		}
+	}
+
+	message := fmt.Sprintf("You are <@%s> (`%s`)\n", user, user)
+	if len(roles) == 0 {
+		message += "Roles: _none_\n"
+	} else {
+		message += "Roles: " + strings.Join(roles, ", ") + "\n"
+	}
+	if len(actions) == 0 {
+		message += "Actions you can run here: _none_"
+	} else {
+		message += "Actions you can run here: " + strings.Join(actions, " ")
+	}
+	response.Reply(message)
+}
+
+// canHandler explains whether the user may run an action in the current channel and why
+func (b *Bot) canHandler(request *Request, response Responder) {
+	name := strings.TrimSpace(request.Param("action"))
+	a := b.FindAction(name)
+	if a == nil {
+		reportError(response, fmt.Errorf("Unknown action %s", name))
+		return
+	}
+	decision := b.Permissions().Check(a, request.User, request.Channel)
+	if decision.Allowed {
+		response.Reply(fmt.Sprintf("Yes, you can run `%s` here (%s)", a.Name, decision.Reason))
+	} else {
+		response.Reply(fmt.Sprintf("No, you can't run `%s` here (%s)", a.Name, decision.Reason))
+	}
+}
+
+// reloadHandler lets admins reload the configuration from chat
+func (b *Bot) reloadHandler(request *Request, response Responder) {
+	if !b.isAdmin(request.User) {
+		reportError(response, fmt.Errorf("Only admins can reload the configuration"))
+		return
+	}
+	if err := b.reportReload("reload command by " + request.User); err != nil {
+		reportError(response, fmt.Errorf("Reload failed, keeping previous config: %s", strings.TrimSpace(err.Error())))
+		return
+	}
+	response.Reply(fmt.Sprintf("Configuration reloaded with %d action(s)", len(b.Config().Actions)))
+}
+
+func runStatus(run Run) string {
+	switch {
+	case run.Cancelled:
+		return "Cancelled by <@" + run.CancelledBy + ">"
+	case run.TimedOut:
+		return "Timed out"
+	default:
+		return "ExitCode: " + strconv.Itoa(run.ReturnCode)
+	}
+}
@@ -0,0 +1,48 @@
+package slackchatops
+
+// Alert colors understood by every Responder
+const (
+	AlertGood    = "good"
+	AlertWarning = "warning"
+	AlertDanger  = "danger"
+)
+
+// Message is a command received by a chat frontend
+type Message struct {
+	ID      string // id of the message (Slack timestamp) so replies can be threaded under it and reactions added, if any
+	User    string // id of the user that sent the message
+	Channel string // channel the message was sent in
+	Text    string // full text of the message
+	Thread  string // thread the message was sent in, if any
+	Slash   bool   // sent as a slash command. Slack routes those to this bot only so SlackChannel doesn't apply
+	Trigger string // lets the frontend open a form in response (Slack trigger_id), if any
+}
+
+// Button is offered below a reply. Clicking it sends Command as if the user had typed it
+type Button struct {
+	Label   string
+	Command string
+	Style   string // "primary", "danger" or empty
+}
+
+// Field is a key/value pair of a result. Short fields are shown side by side
+type Field struct {
+	Title string
+	Value string
+	Short bool
+}
+
+// Responder sends replies back to where a Message came from. The Slack bot is one
+// implementation, other frontends (a terminal, tests) provide their own
+type Responder interface {
+	Reply(text string) (string, error)                      // posts a message and returns an id that can be passed to Edit
+	Alert(color string, title string, text string) error    // posts a highlighted message (AlertGood, AlertWarning or AlertDanger)
+	Buttons(text string, buttons []Button) error            // posts a message with buttons
+	Fields(color string, text string, fields []Field) error // posts a highlighted message with key/value fields
+	Edit(id string, text string) error                      // replaces the text of a message posted by Reply
+	Upload(path string, title string) error                 // uploads a file
+	Typing()                                                // indicates the bot is working on the request
+	Thread() Responder                                      // replies in a thread under the message, or itself when that isn't possible
+	React(emoji string) error                               // adds a reaction (emoji name without colons) to the message
+	Unreact(emoji string) error                             // removes a reaction added with React
+}
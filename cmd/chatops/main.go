@@ -2,10 +2,10 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"net/http"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
+	"syscall"
 
 	"github.com/nlopes/slack"
 	logrus "github.com/sirupsen/logrus"
@@ -16,17 +16,16 @@ import (
 	"github.com/shomali11/slacker"
 )
 
-const (
-	empty   = ""
-	space   = " "
-	dash    = "-"
-	newLine = "\n"
-)
-
-var running bool
-var debugging bool
-
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		repl(os.Args[1:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "secrets" {
+		secrets(os.Args[1:])
+		return
+	}
+
 	//Define command line params and parse input
 	cmdline := cmdline.New()
 	cmdline.AddOption("c", "config", "config.yaml", "Path to configuration file")
@@ -50,161 +49,135 @@ func main() {
 	}
 
 	log := chatops.NewLogger("chatops")
-	debugging = cmdline.IsOptionSet("d")
+	if cmdline.IsOptionSet("d") {
+		log.Logger.SetLevel(logrus.DebugLevel)
+	}
 
 	// Load up configuration file
 	config := LoadConfig(cfgPath)
-	bot := slacker.NewClient(config.SlackToken)
-	bot.Help(helpHandler(bot, config.SlackChannel))
-	bot.DefaultCommand(func(request slacker.Request, response slacker.ResponseWriter) {
+	core := newBot(cfgPath, config, log)
 
-		if config.SlackChannel != "" && config.SlackChannel != request.Event().Channel {
-			return
-		}
-		attachments := []slack.Attachment{}
-		attachments = append(attachments, slack.Attachment{
-			Color: "warning",
-			Title: "Unknown action",
-		})
-		response.Reply("", slacker.WithAttachments(attachments))
-	})
-
-	for _, a := range config.Actions {
-		description := a.Description
-		if description == "" {
-			description = a.Name
-		}
-		params := ""
-		for _, p := range a.Params {
-			params += " <" + p + ">"
-		}
-		err := a.ValidateArgs()
-		if err != nil {
-			color.Yellow("---------------------------------------------------------------------------------")
-			color.Yellow("An action within config.yaml is not parameterized correctly")
-			color.Yellow(err.Error())
-			color.Yellow("---------------------------------------------------------------------------------")
-			os.Exit(1)
+	if config.SlackAPIURL != "" {
+		slack.SLACK_API = config.SlackAPIURL
+	}
+	client := slack.New(config.SlackToken)
+	core.GroupMembers = newUserGroups(client).Members
+	core.Approvals.Members = func(name string) ([]string, error) {
+		if _, role := core.Config().Roles[name]; !role && chatops.IsUserGroupID(name) {
+			return client.GetUserGroupMembers(name)
 		}
-		bot.Command(a.Name+params, description, handler(a, config.SlackChannel, log))
+		return core.Permissions().Members(name)
+	}
+	core.Notify = func(channel string, text string) error {
+		_, _, err := client.PostMessage(channel, text, slack.PostMessageParameters{AsUser: true})
+		return err
+	}
+	core.Responder = func(channel string) chatops.Responder {
+		return chatops.NewSlackResponder(client, channel)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go core.Watch(ctx, hup)
+	go core.RunSchedules(ctx)
+
+	// messages from the events and socket transports are answered through the web API
+	handle := func(message chatops.Message) {
+		core.Handle(ctx, message, chatops.NewMessageResponder(client, config.SlackToken, message))
+	}
+
 	if config.SlackChannel != "" {
 		color.Yellow("only listening on slack channel " + config.SlackChannel)
 	}
-	err := bot.Listen(ctx)
-	if err != nil {
-		log.Fatal(err)
+	core.OpenForm = func(trigger string, a *chatops.Action, channel string) error {
+		return chatops.OpenView(config.SlackAPIURL, config.SlackToken, trigger, chatops.ParamsView(a, channel))
 	}
-}
 
-// overridding default help handler to ensure we only resond to correct channel
-func helpHandler(s *slacker.Slacker, channel string) func(slacker.Request, slacker.ResponseWriter) {
-	return func(request slacker.Request, response slacker.ResponseWriter) {
-		debug("In help handler: Channel:" + request.Event().Channel)
-		//ensure only running for specified channel
-		if channel != "" && channel != request.Event().Channel {
-			return
-		}
-		helpMessage := empty
-		for _, command := range s.BotCommands() {
-			tokens := command.Tokenize()
-			for _, token := range tokens {
-				if token.IsParameter {
-					helpMessage += fmt.Sprintf("`%s`", token.Word) + space
-				} else {
-					helpMessage += fmt.Sprintf("`%s`", token.Word) + space
-				}
-			}
-			helpMessage += dash + space + fmt.Sprintf("_%s_", command.Description()) + newLine
-		}
-		response.Reply(helpMessage)
+	// buttons, forms and slash commands are posted by Slack to an HTTP endpoint verified with the signing secret
+	address := config.ListenAddress
+	if address == "" {
+		address = chatops.DefaultListenAddress
 	}
-}
-
-func handler(a chatops.Action, channel string, log *logrus.Entry) func(slacker.Request, slacker.ResponseWriter) {
-	return func(request slacker.Request, response slacker.ResponseWriter) {
-
-		debug("In handler: Channel:" + request.Event().Channel)
-		//ensure only running for specified channel
-		if channel != "" && channel != request.Event().Channel {
-			return
-		}
-
-		if running {
-			response.Reply("Busy with another action. Please wait...")
-			return
-		}
-
-		authorized := true //Default to true. Only when action has restriction do we limit access
-
-		//This action has authorization check. Ensure user is part of authorized user list
-		if len(a.AuthorizedUsers) > 0 {
-			authorized = false
-			user := request.Event().User
-			for _, u := range a.AuthorizedUsers {
-				if user == u {
-					authorized = true
-				}
-			}
-		}
-
-		if !authorized {
-			attachments := []slack.Attachment{}
-			attachments = append(attachments, slack.Attachment{
-				Color: "danger",
-				Title: "You are not authorized to execute this action",
-			})
-			response.Reply("", slacker.WithAttachments(attachments))
-			return
-		}
-
-		log.WithFields(logrus.Fields{"command": a.Name}).Info("InHandler")
-		var args []string
-		for _, p := range a.Params {
-			arg := request.StringParam(p, "")
-			parts := strings.Split(arg, " ")
-			args = append(args, parts...)
+	if config.SigningSecret != "" {
+		http.Handle("/slack/interactions", &chatops.InteractionHandler{SigningSecret: config.SigningSecret, Bot: core, Client: client})
+		color.Yellow("receiving buttons and forms on " + address + "/slack/interactions")
+	}
+	if config.SlashCommand != "" {
+		if config.SigningSecret == "" {
+			log.Fatal("signingsecret is required for slash commands")
 		}
+		http.Handle("/slack/commands", &chatops.SlashHandler{
+			SigningSecret: config.SigningSecret,
+			Command:       config.SlashCommand,
+			Client:        client,
+			Handle: func(message chatops.Message, response chatops.Responder) {
+				core.Handle(ctx, message, response)
+			},
+			Log: log,
+		})
+		color.Yellow("receiving " + config.SlashCommand + " slash commands on " + address + "/slack/commands")
+	}
+	// always served so triggers added by a reload work without a restart. Unknown names get a 404
+	http.Handle(chatops.TriggerPath, &chatops.TriggerHandler{Bot: core})
+	if len(config.Triggers) > 0 {
+		color.Yellow("receiving triggers on " + address + chatops.TriggerPath + "<name>")
+	}
+	if (config.SigningSecret != "" || len(config.Triggers) > 0) && config.Transport != chatops.TransportEvents {
+		go func() {
+			log.Fatal(http.ListenAndServe(address, nil))
+		}()
+	}
 
-		running = true
-		response.Typing()
-		debugf("Args: %v", args)
-		result, err := a.Run(args...)
-		running = false
-
-		response.Reply("*ExitCode: " + strconv.Itoa(result.ReturnCode) + "*")
-		if result.StdOut != "" {
-			response.Reply("_Output:_\n" + result.StdOut)
+	var err error
+	switch config.Transport {
+	case chatops.TransportEvents:
+		if config.SigningSecret == "" {
+			log.Fatal("signingsecret is required for the events transport")
 		}
-		if err != nil {
-			response.Reply("_Error:_\n" + result.StdError)
-		}
-
-		outputFile, _ := chatops.ExpandPath(a.OutputFile)
-		//is there a file to upload (say test results)
-		if _, err := os.Stat(outputFile); err == nil {
-			rtm := response.RTM()
-			client := response.Client()
-
-			rtm.SendMessage(rtm.NewOutgoingMessage("Uploading output file ...", request.Event().Channel))
-			client.UploadFile(slack.FileUploadParameters{File: outputFile, Channels: []string{channel}})
-			os.Remove(outputFile)
+		http.Handle("/slack/events", &chatops.EventsHandler{SigningSecret: config.SigningSecret, Handle: handle, Log: log})
+		color.Yellow("receiving Slack events on " + address + "/slack/events")
+		err = http.ListenAndServe(address, nil)
+	case chatops.TransportSocket:
+		if config.AppToken == "" {
+			log.Fatal("apptoken is required for the socket transport")
 		}
+		socket := &chatops.SocketMode{AppToken: config.AppToken, APIURL: config.SlackAPIURL, Handle: handle, Log: log}
+		err = socket.Run(ctx)
+	default:
+		err = listenRTM(ctx, config.SlackToken, core)
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
 }
 
-func debug(msg string) {
-	if debugging {
-		fmt.Println(msg)
+// listenRTM receives messages over slacker's RTM connection. Actions aren't registered with
+// slacker so the whole set can be swapped on reload. Every message is handed to the bot which
+// matches it against its own commands
+func listenRTM(ctx context.Context, token string, core *chatops.Bot) error {
+	bot := slacker.NewClient(token)
+	forward := func(request slacker.Request, response slacker.ResponseWriter) {
+		event := request.Event()
+		message := chatops.Message{ID: event.Timestamp, User: event.User, Channel: event.Channel, Text: event.Text, Thread: event.ThreadTimestamp}
+		core.Handle(request.Context(), message, newSlackResponder(response, token, message))
 	}
+	bot.Help(forward)
+	bot.DefaultCommand(forward)
+	return bot.Listen(ctx)
 }
 
-func debugf(format string, a ...interface{}) {
-	if debugging {
-		fmt.Printf(format+"\n", a)
+// newBot creates the bot for the configuration or exits when an action is invalid
+func newBot(cfgPath string, config *chatops.Config, log *logrus.Entry) *chatops.Bot {
+	core, err := chatops.NewBot(cfgPath, config, log)
+	if err != nil {
+		color.Yellow("---------------------------------------------------------------------------------")
+		color.Yellow("An action within config.yaml is not parameterized correctly")
+		color.Yellow(err.Error())
+		color.Yellow("---------------------------------------------------------------------------------")
+		os.Exit(1)
 	}
+	return core
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fatih/color"
+	cmdline "github.com/galdor/go-cmdline"
+	chatops "github.com/mkobaly/slackchatops"
+	logrus "github.com/sirupsen/logrus"
+)
+
+const defaultReplUser = "ULOCAL"
+
+var mentionPattern = regexp.MustCompile(`<(?:@|!subteam\^)([A-Z0-9]+)>`)
+
+// repl reads commands from stdin and runs them through the same bot as Slack would.
+// Commands run concurrently like they do in Slack so a request waiting for approval
+// can be approved from the next line
+func repl(args []string) {
+	cmdline := cmdline.New()
+	cmdline.AddOption("c", "config", "config.yaml", "Path to configuration file")
+	cmdline.AddOption("u", "as", "slackId", "User the commands are sent as")
+	cmdline.AddOption("C", "channel", "channel", "Channel the commands are sent in (defaults to slackchannel)")
+	cmdline.AddFlag("d", "debug", "Log additional information for debugging purposes")
+	cmdline.Parse(args)
+
+	cfgPath := "./config.yaml"
+	if cmdline.IsOptionSet("c") {
+		cfgPath = cmdline.OptionValue("c")
+	}
+	log := chatops.NewLogger("chatops")
+	log.Logger.SetLevel(logrus.WarnLevel)
+	if cmdline.IsOptionSet("d") {
+		log.Logger.SetLevel(logrus.DebugLevel)
+	}
+
+	config, err := chatops.ReadConfig(cfgPath)
+	if err != nil {
+		color.Red(err.Error())
+		os.Exit(1)
+	}
+	core := newBot(cfgPath, config, log)
+
+	message := chatops.Message{User: defaultReplUser, Channel: config.SlackChannel}
+	if cmdline.IsOptionSet("u") {
+		message.User = cmdline.OptionValue("u")
+	}
+	if cmdline.IsOptionSet("C") {
+		message.Channel = cmdline.OptionValue("C")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		cancel()
+		os.Exit(130)
+	}()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go core.Watch(ctx, hup)
+
+	response := &terminalResponder{out: os.Stdout}
+	fmt.Printf("Sending commands as %s in %s. Type `help` for the list of commands, `:as <slackId>` or `:channel <channel>` to switch\n", message.User, message.Channel)
+
+	var running sync.WaitGroup
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+			continue
+		case text == ":quit":
+			running.Wait()
+			return
+		case strings.HasPrefix(text, ":as "):
+			message.User = strings.TrimSpace(strings.TrimPrefix(text, ":as "))
+			continue
+		case strings.HasPrefix(text, ":channel "):
+			message.Channel = strings.TrimSpace(strings.TrimPrefix(text, ":channel "))
+			continue
+		}
+
+		m := message
+		m.Text = text
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			core.Handle(ctx, m, response)
+		}()
+	}
+	running.Wait()
+}
+
+// terminalResponder prints replies to the terminal, translating the Slack markup that
+// doesn't read well there
+type terminalResponder struct {
+	mu  sync.Mutex
+	out io.Writer
+	ids int
+}
+
+// Reply prints the text and returns a sequence number so edits can refer to it
+func (r *terminalResponder) Reply(text string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids++
+	fmt.Fprintln(r.out, terminalText(text))
+	return strconv.Itoa(r.ids), nil
+}
+
+// Alert prints the title in the alert's color
+func (r *terminalResponder) Alert(alert string, title string, text string) error {
+	c := color.New(color.FgGreen)
+	switch alert {
+	case chatops.AlertWarning:
+		c = color.New(color.FgYellow)
+	case chatops.AlertDanger:
+		c = color.New(color.FgRed)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c.Fprintln(r.out, title)
+	if text != "" {
+		fmt.Fprintln(r.out, terminalText(text))
+	}
+	return nil
+}
+
+// Buttons prints the commands the buttons would send
+func (r *terminalResponder) Buttons(text string, buttons []chatops.Button) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintln(r.out, terminalText(text))
+	for _, button := range buttons {
+		fmt.Fprintf(r.out, "  [%s] type `%s`\n", button.Label, button.Command)
+	}
+	return nil
+}
+
+// Fields prints the text followed by one line per field
+func (r *terminalResponder) Fields(alert string, text string, fields []chatops.Field) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if text != "" {
+		fmt.Fprintln(r.out, terminalText(text))
+	}
+	for _, field := range fields {
+		fmt.Fprintf(r.out, "  %s: %s\n", color.New(color.Bold).Sprint(field.Title), terminalText(field.Value))
+	}
+	return nil
+}
+
+// Edit prints the new text again since the terminal can't change earlier output
+func (r *terminalResponder) Edit(id string, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	color.New(color.Faint).Fprintf(r.out, "[%s edited]\n", id)
+	fmt.Fprintln(r.out, terminalText(text))
+	return nil
+}
+
+// Upload prints where the file is instead of uploading it
+func (r *terminalResponder) Upload(path string, title string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.out, "Uploaded %s (%s)\n", path, title)
+	return nil
+}
+
+// Typing does nothing in a terminal
+func (r *terminalResponder) Typing() {}
+
+// Thread returns the responder itself since the terminal has no threads
+func (r *terminalResponder) Thread() chatops.Responder {
+	return r
+}
+
+// React prints the reaction the message would get in Slack
+func (r *terminalResponder) React(emoji string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	color.New(color.Faint).Fprintf(r.out, "[:%s:]\n", emoji)
+	return nil
+}
+
+// Unreact does nothing since printed reactions can't be removed
+func (r *terminalResponder) Unreact(emoji string) error {
+	return nil
+}
+
+// terminalText strips code fences and turns mentions into @slackId
+func terminalText(text string) string {
+	text = strings.Replace(text, "```", "\n", -1)
+	text = mentionPattern.ReplaceAllString(text, "@$1")
+	return strings.TrimRight(text, "\n")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	cmdline "github.com/galdor/go-cmdline"
+	chatops "github.com/mkobaly/slackchatops"
+)
+
+// secrets manages the encrypted secrets file actions read secret:name env values from.
+// Values are read from stdin so they don't end up in the shell history
+func secrets(args []string) {
+	cmdline := cmdline.New()
+	cmdline.AddOption("c", "config", "config.yaml", "Path to configuration file")
+	cmdline.AddCommand("key", "Print a new random key to export as "+chatops.SecretsKeyEnv)
+	cmdline.AddCommand("list", "List the names of the secrets")
+	cmdline.AddCommand("set", "Set the secret <name> to the value read from stdin")
+	cmdline.AddCommand("delete", "Remove the secret <name>")
+	cmdline.Parse(args)
+
+	if cmdline.CommandName() == "key" {
+		key, err := chatops.NewSecretsKey()
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	cfgPath := "./config.yaml"
+	if cmdline.IsOptionSet("c") {
+		cfgPath = cmdline.OptionValue("c")
+	}
+	config, err := chatops.ReadConfig(cfgPath)
+	if err != nil {
+		fail(err)
+	}
+	path := config.SecretsFile
+	if path == "" {
+		path = chatops.DefaultSecretsFile
+	}
+	path, _ = chatops.ExpandPath(path)
+	key := os.Getenv(chatops.SecretsKeyEnv)
+	stored, err := chatops.ReadSecrets(path, key)
+	if err != nil {
+		fail(err)
+	}
+
+	names := cmdline.CommandArgumentsValues()
+	switch cmdline.CommandName() {
+	case "list":
+		sorted := []string{}
+		for name := range stored {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+		for _, name := range sorted {
+			fmt.Println(name)
+		}
+		return
+	case "set":
+		if len(names) != 1 {
+			fail(fmt.Errorf("Usage: secrets set <name>"))
+		}
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value == "" {
+			fail(fmt.Errorf("No value read from stdin"))
+		}
+		stored[names[0]] = strings.TrimRight(value, "\r\n")
+	case "delete":
+		if len(names) != 1 {
+			fail(fmt.Errorf("Usage: secrets delete <name>"))
+		}
+		if _, ok := stored[names[0]]; !ok {
+			fail(fmt.Errorf("No secret %s in %s", names[0], path))
+		}
+		delete(stored, names[0])
+	}
+	if err := stored.Write(path, key); err != nil {
+		fail(err)
+	}
+	color.Green("Saved %s", path)
+}
+
+func fail(err error) {
+	color.Red(err.Error())
+	os.Exit(1)
+}
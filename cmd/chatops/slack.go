@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	chatops "github.com/mkobaly/slackchatops"
+	"github.com/nlopes/slack"
+	"github.com/shomali11/slacker"
+)
+
+const userGroupCacheTime = 5 * time.Minute
+
+// userGroups resolves Slack user group handles to their members. Results are cached
+// so permission checks don't call the Slack API on every command
+type userGroups struct {
+	client  *slack.Client
+	mu      sync.Mutex
+	fetched map[string]time.Time
+	members map[string][]string
+}
+
+func newUserGroups(client *slack.Client) *userGroups {
+	return &userGroups{client: client, fetched: map[string]time.Time{}, members: map[string][]string{}}
+}
+
+// Members returns the slackIds of the user group with the given handle
+func (g *userGroups) Members(handle string) ([]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Since(g.fetched[handle]) < userGroupCacheTime {
+		return g.members[handle], nil
+	}
+
+	groups, err := g.client.GetUserGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.Handle != handle {
+			continue
+		}
+		members, err := g.client.GetUserGroupMembers(group.ID)
+		if err != nil {
+			return nil, err
+		}
+		g.members[handle] = members
+		g.fetched[handle] = time.Now()
+		return members, nil
+	}
+	return nil, fmt.Errorf("Unknown Slack user group @%s", handle)
+}
+
+// slackResponder replies through the web API and shows typing indicators over the RTM connection
+type slackResponder struct {
+	*chatops.SlackResponder
+	response slacker.ResponseWriter
+}
+
+func newSlackResponder(response slacker.ResponseWriter, token string, message chatops.Message) *slackResponder {
+	return &slackResponder{SlackResponder: chatops.NewMessageResponder(response.Client(), token, message), response: response}
+}
+
+// Typing shows the typing indicator
+func (r *slackResponder) Typing() {
+	r.response.Typing()
+}
@@ -0,0 +1,85 @@
+package slackchatops
+
+import (
+	"io/ioutil"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config represents all of the settings needed to run the chatOps application
+type Config struct {
+	SlackToken      string
+	SlackChannel    string
+	Transport       string              // how messages are received: rtm (default), events (Events API over HTTP) or socket (Socket Mode)
+	SigningSecret   string              // verifies requests of the events transport
+	AppToken        string              // app level token (xapp-...) used by the socket transport
+	ListenAddress   string              // address the events transport listens on. Defaults to :3000
+	SlashCommand    string              // slash command (ex: /ops) accepted on listenaddress/slack/commands. Needs signingsecret
+	SlackAPIURL     string              // overrides https://slack.com/api/ (ex: a local fake Slack server for testing)
+	Timeout         time.Duration       // default timeout for actions that don't define their own. Zero means no limit
+	StreamInterval  time.Duration       // how often the message of a streaming action is updated. Defaults to 3s to stay under Slack's rate limits
+	Replies         string              // where replies to actions go unless they set their own: thread (default), quiet or channel
+	InlineLines     int                 // output longer than this many lines is uploaded as a file with a preview. Defaults to 40
+	PreviewLines    int                 // lines of the start and end of long output shown in the preview. Defaults to 10
+	MaxUploadMB     int                 // output files larger than this are not uploaded. Defaults to 20
+	ArchiveDir      string              // directory uploaded output files are moved to by actions with afterupload: archive
+	HistoryFile     string              // file every run is recorded to. Defaults to history.jsonl
+	HistoryMaxAge   time.Duration       // runs older than this are removed from the history. Zero keeps them forever
+	HistoryMaxRuns  int                 // only this many of the latest runs are kept. Zero keeps all of them
+	ApprovalTimeout time.Duration       // how long approval requests stay open. Defaults to 1h
+	ConfirmTimeout  time.Duration       // how long users have to confirm actions with confirm set. Defaults to 1m
+	ScheduleFile    string              // file the last run and paused state of schedules are saved to. Defaults to schedules.json
+	SecretsFile     string              // encrypted file secret:name env values are read from. Defaults to secrets.enc
+	Env             map[string]string   // environment variables of every action. Values may be env:NAME, file:path or secret:name
+	Roles           map[string][]string // role name to members (slackIds or Slack user group handles such as @oncall)
+	Admins          []string            // slackIds or roles allowed to run admin commands such as reload
+	AdminChannel    string              // channel configuration problems are reported to
+	Actions         []Action
+	Workflows       []Workflow
+	Schedules       []Schedule
+	Triggers        []Trigger
+}
+
+// FindAction returns the action with the given name or nil when there isn't one
+func (c *Config) FindAction(name string) *Action {
+	for i := range c.Actions {
+		if c.Actions[i].Name == name {
+			return &c.Actions[i]
+		}
+	}
+	return nil
+}
+
+// Write will save the configuration to the given path
+func (c *Config) Write(path string) error {
+	bytes, err := yaml.Marshal(c)
+	if err == nil {
+		return ioutil.WriteFile(path, bytes, 0777)
+	}
+	return err
+}
+
+// Print will dump the configuration to a string
+func (c *Config) Print() (string, error) {
+	bytes, err := yaml.Marshal(c)
+	if err == nil {
+		return string(bytes), nil
+	}
+	return "", err
+}
+
+// ReadConfig loads a Config object based on configPath returning any problem as an error
+func ReadConfig(configPath string) (*Config, error) {
+	var config = new(Config)
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
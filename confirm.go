@@ -0,0 +1,176 @@
+package slackchatops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConfirmTimeout is how long a user has to confirm an action when none is configured
+const DefaultConfirmTimeout = time.Minute
+
+var (
+	// ErrDeclined is returned when the user cancelled instead of confirming
+	ErrDeclined = errors.New("confirmation declined")
+	// ErrNotConfirmed is returned when the user didn't confirm in time
+	ErrNotConfirmed = errors.New("not confirmed in time")
+)
+
+// Confirm makes an action ask the user that requested it to confirm before it runs. In
+// config.yaml it is either `true` or the question to ask
+type Confirm struct {
+	Enabled bool
+	Text    string
+}
+
+// UnmarshalYAML accepts a bool or the question
+func (c *Confirm) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var enabled bool
+	if err := unmarshal(&enabled); err == nil {
+		*c = Confirm{Enabled: enabled}
+		return nil
+	}
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	*c = Confirm{Enabled: text != "", Text: text}
+	return nil
+}
+
+// MarshalYAML writes the question, or just true/false when there isn't one
+func (c Confirm) MarshalYAML() (interface{}, error) {
+	if c.Text != "" {
+		return c.Text, nil
+	}
+	return c.Enabled, nil
+}
+
+// Question returns the text asking for confirmation
+func (c Confirm) Question() string {
+	if c.Text != "" {
+		return c.Text
+	}
+	return "Are you sure?"
+}
+
+// Confirmation is a pending request for a user to confirm an action
+type Confirmation struct {
+	Token   string
+	User    string
+	Expires time.Time
+
+	mu   sync.Mutex
+	err  error
+	done chan struct{}
+}
+
+// Wait blocks until the user confirmed (nil), declined (ErrDeclined) or the request expired (ErrNotConfirmed)
+func (c *Confirmation) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Confirmations keeps track of actions waiting to be confirmed
+type Confirmations struct {
+	Timeout time.Duration // how long a request stays open. Defaults to DefaultConfirmTimeout
+
+	mu      sync.Mutex
+	pending map[string]*Confirmation
+}
+
+// NewConfirmations creates an empty set of confirmation requests
+func NewConfirmations(timeout time.Duration) *Confirmations {
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+	return &Confirmations{Timeout: timeout, pending: map[string]*Confirmation{}}
+}
+
+// Request asks the user for confirmation. It expires after the Timeout
+func (p *Confirmations) Request(user string) *Confirmation {
+	confirmation := &Confirmation{User: user, Expires: time.Now().Add(p.Timeout), done: make(chan struct{})}
+	p.mu.Lock()
+	for {
+		confirmation.Token = newJobID()
+		if _, exists := p.pending[confirmation.Token]; !exists {
+			break
+		}
+	}
+	p.pending[confirmation.Token] = confirmation
+	p.mu.Unlock()
+
+	time.AfterFunc(p.Timeout, func() {
+		p.finish(confirmation.Token, ErrNotConfirmed)
+	})
+	return confirmation
+}
+
+// Confirm lets the action run. Only the user that requested it can confirm
+func (p *Confirmations) Confirm(token string, user string) error {
+	if err := p.check(token, user); err != nil {
+		return err
+	}
+	p.finish(token, nil)
+	return nil
+}
+
+// Decline cancels the action. Only the user that requested it can decline
+func (p *Confirmations) Decline(token string, user string) error {
+	if err := p.check(token, user); err != nil {
+		return err
+	}
+	p.finish(token, ErrDeclined)
+	return nil
+}
+
+func (p *Confirmations) check(token string, user string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	confirmation, ok := p.pending[token]
+	if !ok {
+		return fmt.Errorf("Nothing to confirm with token %s", token)
+	}
+	if confirmation.User != user {
+		return fmt.Errorf("Only <@%s> can confirm %s", confirmation.User, token)
+	}
+	return nil
+}
+
+// finish removes the request and wakes up Wait. Only the first call has an effect
+func (p *Confirmations) finish(token string, err error) {
+	p.mu.Lock()
+	confirmation, ok := p.pending[token]
+	delete(p.pending, token)
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	confirmation.mu.Lock()
+	confirmation.err = err
+	close(confirmation.done)
+	confirmation.mu.Unlock()
+}
+
+// CommandLine shows the command and arguments that will be executed, quoting arguments
+// that contain spaces or quotes
+func CommandLine(command string, args []string) string {
+	parts := []string{command}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
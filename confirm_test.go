@@ -0,0 +1,103 @@
+package slackchatops
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestConfirmYAML(t *testing.T) {
+	var actions []Action
+	err := yaml.Unmarshal([]byte("- name: a\n  confirm: true\n- name: b\n  confirm: Restart prod?\n- name: c\n"), &actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !actions[0].Confirm.Enabled || actions[0].Confirm.Question() != "Are you sure?" {
+		t.Errorf("unexpected confirm %+v", actions[0].Confirm)
+	}
+	if !actions[1].Confirm.Enabled || actions[1].Confirm.Question() != "Restart prod?" {
+		t.Errorf("unexpected confirm %+v", actions[1].Confirm)
+	}
+	if actions[2].Confirm.Enabled {
+		t.Errorf("expected confirm to be off by default")
+	}
+}
+
+func TestConfirmations(t *testing.T) {
+	confirmations := NewConfirmations(50 * time.Millisecond)
+
+	c := confirmations.Request("U1")
+	if err := confirmations.Confirm(c.Token, "U2"); err == nil {
+		t.Errorf("expected other users not to be able to confirm")
+	}
+	confirmations.Confirm(c.Token, "U1")
+	if err := c.Wait(context.Background()); err != nil {
+		t.Errorf("expected confirmed but got %v", err)
+	}
+
+	c = confirmations.Request("U1")
+	confirmations.Decline(c.Token, "U1")
+	if err := c.Wait(context.Background()); err != ErrDeclined {
+		t.Errorf("expected declined but got %v", err)
+	}
+
+	c = confirmations.Request("U1")
+	if err := c.Wait(context.Background()); err != ErrNotConfirmed {
+		t.Errorf("expected expiry but got %v", err)
+	}
+	if err := confirmations.Confirm(c.Token, "U1"); err == nil {
+		t.Errorf("expected expired token to be unknown")
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	if line := CommandLine("sh", []string{"-c", "echo hi", ""}); line != `sh -c "echo hi" ""` {
+		t.Errorf("unexpected command line %s", line)
+	}
+}
+
+func TestBotAsksForConfirmation(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "restart", Command: "echo", Args: []string{"restarting", "{0}"}, Params: []Param{{Name: "service"}}, Confirm: Confirm{Enabled: true, Text: "Restart prod?"}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	done := make(chan struct{})
+	go func() {
+		bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "restart api"}, response)
+		close(done)
+	}()
+
+	token := ""
+	tokenPattern := regexp.MustCompile("`yes ([0-9a-f]+)`")
+	for i := 0; i < 500 && token == ""; i++ {
+		if match := tokenPattern.FindStringSubmatch(response.text()); match != nil {
+			token = match[1]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if text := response.text(); !strings.Contains(text, "Restart prod?") || !strings.Contains(text, "echo restarting api") {
+		t.Fatalf("expected question and command line but got %s", text)
+	}
+
+	other := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U2", Channel: "C1", Text: "yes " + token}, other)
+	if !strings.Contains(other.text(), "Only <@U1> can confirm") {
+		t.Errorf("expected other users to be refused but got %s", other.text())
+	}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "yes " + token}, response)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("action did not run after confirmation")
+	}
+	if text := response.text(); !strings.Contains(text, "ExitCode: 0") {
+		t.Errorf("expected action to run but got %s", text)
+	}
+}
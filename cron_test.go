@@ -0,0 +1,48 @@
+package slackchatops
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	start := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"*/15 * * * *", start, time.Date(2024, 1, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", start, time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", start, time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 feb *", start, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 13 * 5", start, time.Date(2024, 2, 2, 12, 0, 0, 0, time.UTC)}, // either the 13th or a friday
+		{"@hourly", start, time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", start, time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"5/20 1,3 * * *", start, time.Date(2024, 2, 1, 1, 5, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, 3, 30, 12, 0, 0, 0, paris), time.Date(2024, 4, 1, 2, 30, 0, 0, paris)}, // 2:30 doesn't exist on the 31st
+		{"0 0 30 2 *", start, time.Time{}},
+	}
+	for _, test := range tests {
+		cron, err := ParseCron(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if next := cron.Next(test.from); !next.Equal(test.expected) {
+			t.Errorf("%s: expected %s but got %s", test.expr, test.expected, next)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("expected %q to be invalid", expr)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package slackchatops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// Transports selecting how the bot receives messages from Slack
+const (
+	TransportRTM    = "rtm"
+	TransportEvents = "events"
+	TransportSocket = "socket"
+)
+
+// DefaultListenAddress is used by the events transport when the configuration doesn't set one
+const DefaultListenAddress = ":3000"
+
+// maxSignatureAge rejects replayed requests
+const maxSignatureAge = 5 * time.Minute
+
+// ErrBadSignature is returned when a request wasn't signed with the signing secret
+var ErrBadSignature = errors.New("Invalid Slack signature")
+
+// VerifySignature checks the X-Slack-Signature header of a request against the app's signing secret
+func VerifySignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return ErrBadSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// eventCallback is the part of an Events API payload the bot uses
+type eventCallback struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     struct {
+		Type        string `json:"type"`
+		Subtype     string `json:"subtype"`
+		User        string `json:"user"`
+		BotID       string `json:"bot_id"`
+		Channel     string `json:"channel"`
+		ChannelType string `json:"channel_type"`
+		Text        string `json:"text"`
+		TS          string `json:"ts"`
+		ThreadTS    string `json:"thread_ts"`
+	} `json:"event"`
+}
+
+// message returns the Message of an event the bot should respond to: mentions of the bot
+// and direct messages, the same ones the RTM connection responds to
+func (e *eventCallback) message() (Message, bool) {
+	event := e.Event
+	if e.Type != "event_callback" || event.BotID != "" || event.Subtype != "" || event.User == "" {
+		return Message{}, false
+	}
+	if event.Type != "app_mention" && !(event.Type == "message" && event.ChannelType == "im") {
+		return Message{}, false
+	}
+	return Message{ID: event.TS, User: event.User, Channel: event.Channel, Text: event.Text, Thread: event.ThreadTS}, true
+}
+
+// EventsHandler receives Slack events over HTTP (Events API). Requests are acknowledged
+// right away and the message is handled in the background
+type EventsHandler struct {
+	SigningSecret string
+	Handle        func(message Message)
+	Log           *logrus.Entry
+}
+
+// ServeHTTP verifies the request and dispatches its message
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := VerifySignature(h.SigningSecret, r.Header, body, time.Now()); err != nil {
+		h.Log.WithFields(logrus.Fields{"remote": r.RemoteAddr}).Warn(err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var callback eventCallback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if callback.Type == "url_verification" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(callback.Challenge))
+		return
+	}
+	// Slack retries events it thinks weren't received. The first delivery was already handled
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		return
+	}
+	if message, ok := callback.message(); ok {
+		go h.Handle(message)
+	}
+}
@@ -0,0 +1,87 @@
+package slackchatops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedRequest(secret string, body string, at time.Time) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	request := httptest.NewRequest("POST", "/slack/events", strings.NewReader(body))
+	request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return request
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Now()
+	request := signedRequest("secret", "body", now)
+	if err := VerifySignature("secret", request.Header, []byte("body"), now); err != nil {
+		t.Errorf("expected valid signature but got %v", err)
+	}
+	if err := VerifySignature("other", request.Header, []byte("body"), now); err != ErrBadSignature {
+		t.Errorf("expected wrong secret to fail but got %v", err)
+	}
+	if err := VerifySignature("secret", request.Header, []byte("changed"), now); err != ErrBadSignature {
+		t.Errorf("expected changed body to fail but got %v", err)
+	}
+	if err := VerifySignature("secret", request.Header, []byte("body"), now.Add(10*time.Minute)); err != ErrBadSignature {
+		t.Errorf("expected old request to fail but got %v", err)
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	messages := make(chan Message, 1)
+	handler := &EventsHandler{SigningSecret: "secret", Handle: func(m Message) { messages <- m }, Log: NewLogger("test")}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, signedRequest("secret", `{"type":"url_verification","challenge":"abc"}`, time.Now()))
+	if recorder.Body.String() != "abc" {
+		t.Errorf("expected challenge to be echoed but got %q", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, signedRequest("wrong", `{"type":"event_callback"}`, time.Now()))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a bad signature but got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	body := `{"type":"event_callback","event":{"type":"app_mention","user":"U1","channel":"C1","text":"<@UBOT> deploy 1.2"}}`
+	handler.ServeHTTP(recorder, signedRequest("secret", body, time.Now()))
+	select {
+	case m := <-messages:
+		if m.User != "U1" || m.Channel != "C1" || m.Text != "<@UBOT> deploy 1.2" {
+			t.Errorf("unexpected message %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not handled")
+	}
+}
+
+func TestEventsIgnoresBotsAndChannelMessages(t *testing.T) {
+	tests := []string{
+		`{"type":"event_callback","event":{"type":"app_mention","bot_id":"B1","channel":"C1","text":"hi"}}`,
+		`{"type":"event_callback","event":{"type":"message","user":"U1","channel":"C1","channel_type":"channel","text":"deploy"}}`,
+		`{"type":"event_callback","event":{"type":"message","subtype":"message_changed","user":"U1","channel":"D1","channel_type":"im"}}`,
+	}
+	for _, body := range tests {
+		var callback eventCallback
+		if err := json.Unmarshal([]byte(body), &callback); err != nil {
+			t.Fatal(err)
+		}
+		if m, ok := callback.message(); ok {
+			t.Errorf("expected %s to be ignored but got %+v", body, m)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package slackchatops
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode/utf8"
+)
+
+// Names of the built in formatters
+const (
+	FormatCode      = "code"      // output in a code block
+	FormatJSON      = "json"      // pretty printed JSON
+	FormatJSONTable = "jsontable" // JSON array of objects (or an object) as a table
+	FormatCSVTable  = "csvtable"  // CSV with a header row as a table
+	FormatFields    = "fields"    // JSON object or key: value lines as attachment fields
+	FormatRegex     = "regex"     // only the lines matching Pattern
+	FormatTemplate  = "template"  // Go text/template with the Run as data
+)
+
+// shortFieldLength is the longest value shown side by side with other fields
+const shortFieldLength = 40
+
+// Output selects how the result of an action is posted. In config.yaml it is either the name
+// of a formatter or a map with the formatter's settings
+type Output struct {
+	Format   string   // name of the formatter. Empty keeps the plain ExitCode, Output and Error replies
+	Pattern  string   // regular expression of the summary lines kept by regex
+	Template string   // text/template used by template. The data is the Run
+	Columns  []string // columns shown by jsontable and csvtable (or fields shown by fields), in order. Defaults to all of them
+}
+
+// UnmarshalYAML accepts the formatter's name or its settings
+func (o *Output) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var format string
+	if err := unmarshal(&format); err == nil {
+		*o = Output{Format: format}
+		return nil
+	}
+	type settings Output
+	return unmarshal((*settings)(o))
+}
+
+// MarshalYAML writes just the formatter's name when it has no settings
+func (o Output) MarshalYAML() (interface{}, error) {
+	if o.Pattern == "" && o.Template == "" && len(o.Columns) == 0 {
+		return o.Format, nil
+	}
+	type settings Output
+	return settings(o), nil
+}
+
+// Validate checks the formatter exists and accepts the settings
+func (o *Output) Validate() error {
+	if o.Format == "" {
+		return nil
+	}
+	f, ok := FindFormatter(o.Format)
+	if !ok {
+		return fmt.Errorf("unknown output format %s", o.Format)
+	}
+	return f.Validate(*o)
+}
+
+// Render formats a finished run
+func (o *Output) Render(run Run) (Formatted, error) {
+	f, ok := FindFormatter(o.Format)
+	if !ok {
+		return Formatted{}, fmt.Errorf("unknown output format %s", o.Format)
+	}
+	return f.Format(*o, run)
+}
+
+// Formatted is the message built by a Formatter. Fields are posted as key/value pairs below the text
+type Formatted struct {
+	Text   string
+	Fields []Field
+}
+
+// escape escapes the text and fields so the output they show can't mention users or channels
+func (f Formatted) escape() Formatted {
+	escaped := Formatted{Text: escapeSlack(f.Text)}
+	for _, field := range f.Fields {
+		escaped.Fields = append(escaped.Fields, Field{Title: escapeSlack(field.Title), Value: escapeSlack(field.Value), Short: field.Short})
+	}
+	return escaped
+}
+
+// Formatter turns the run of an action into the message posted once it finished. The run's output
+// has its terminal escape codes removed but is otherwise as the command wrote it. The message is
+// escaped for Slack before it is posted
+type Formatter interface {
+	Validate(output Output) error                     // checks the settings when the configuration is loaded
+	Format(output Output, run Run) (Formatted, error) // builds the message. Errors fall back to the plain replies
+}
+
+// formatter implements Formatter with functions
+type formatter struct {
+	validate func(output Output) error
+	format   func(output Output, run Run) (Formatted, error)
+}
+
+func (f formatter) Validate(output Output) error {
+	if f.validate == nil {
+		return nil
+	}
+	return f.validate(output)
+}
+
+func (f formatter) Format(output Output, run Run) (Formatted, error) {
+	return f.format(output, run)
+}
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{
+		FormatCode:      formatter{format: formatCode},
+		FormatJSON:      formatter{format: formatJSON},
+		FormatJSONTable: formatter{format: formatJSONTable},
+		FormatCSVTable:  formatter{format: formatCSVTable},
+		FormatFields:    formatter{format: formatFields},
+		FormatRegex:     formatter{validate: validateRegex, format: formatRegex},
+		FormatTemplate:  formatter{validate: validateTemplate, format: formatTemplate},
+	}
+)
+
+// RegisterFormatter makes a formatter available to the Output of actions. Register custom
+// formatters before creating the Bot. Built in formatters can be replaced
+func RegisterFormatter(name string, f Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[name] = f
+}
+
+// FindFormatter returns the formatter registered under name
+func FindFormatter(name string) (Formatter, bool) {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	f, ok := formatters[name]
+	return f, ok
+}
+
+// resultText puts the exit code above the formatted output and adds stderr when the run failed
+func resultText(run Run, body string) string {
+	text := "*ExitCode: " + strconv.Itoa(run.ReturnCode) + "*"
+	if body != "" {
+		text += "\n" + body
+	}
+	if run.ReturnCode != 0 && strings.TrimSpace(run.StdError) != "" {
+		text += "\n_Error:_\n" + codeBlock(run.StdError)
+	}
+	return text
+}
+
+func formatCode(output Output, run Run) (Formatted, error) {
+	if strings.TrimSpace(run.StdOut) == "" {
+		return Formatted{Text: resultText(run, "")}, nil
+	}
+	return Formatted{Text: resultText(run, codeBlock(run.StdOut))}, nil
+}
+
+func formatJSON(output Output, run Run) (Formatted, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(run.StdOut), &value); err != nil {
+		return Formatted{}, err
+	}
+	pretty, err := marshalJSON(value, "  ")
+	if err != nil {
+		return Formatted{}, err
+	}
+	return Formatted{Text: resultText(run, codeBlock(pretty))}, nil
+}
+
+// marshalJSON encodes the value without escaping &, < and > like json.Marshal does, so strings
+// are shown as the command wrote them
+func marshalJSON(value interface{}, indent string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func formatJSONTable(output Output, run Run) (Formatted, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(run.StdOut), &value); err != nil {
+		return Formatted{}, err
+	}
+
+	var header []string
+	var rows [][]string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		header = []string{"key", "value"}
+		for _, key := range keys(v, output.Columns) {
+			rows = append(rows, []string{key, cell(v[key])})
+		}
+	case []interface{}:
+		objects := []map[string]interface{}{}
+		all := map[string]interface{}{}
+		for _, item := range v {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return Formatted{}, fmt.Errorf("jsontable needs an array of objects")
+			}
+			objects = append(objects, object)
+			for key := range object {
+				all[key] = true
+			}
+		}
+		header = keys(all, output.Columns)
+		for _, object := range objects {
+			row := make([]string, len(header))
+			for i, key := range header {
+				row[i] = cell(object[key])
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return Formatted{}, fmt.Errorf("jsontable needs an array of objects or an object")
+	}
+	return Formatted{Text: resultText(run, textTable(header, rows))}, nil
+}
+
+func formatCSVTable(output Output, run Run) (Formatted, error) {
+	reader := csv.NewReader(strings.NewReader(run.StdOut))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Formatted{}, err
+	}
+	if len(records) == 0 {
+		return Formatted{Text: resultText(run, "_No output_")}, nil
+	}
+	header, rows := records[0], records[1:]
+	if len(output.Columns) > 0 {
+		indexes := []int{}
+		for _, column := range output.Columns {
+			for i, name := range header {
+				if name == column {
+					indexes = append(indexes, i)
+				}
+			}
+		}
+		pick := func(record []string) []string {
+			picked := make([]string, len(indexes))
+			for i, index := range indexes {
+				if index < len(record) {
+					picked[i] = record[index]
+				}
+			}
+			return picked
+		}
+		for i := range rows {
+			rows[i] = pick(rows[i])
+		}
+		header = pick(header)
+	}
+	return Formatted{Text: resultText(run, textTable(header, rows))}, nil
+}
+
+func formatFields(output Output, run Run) (Formatted, error) {
+	values := map[string]interface{}{}
+	order := []string{}
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(run.StdOut), &object); err == nil {
+		values = object
+	} else {
+		// key: value or key=value lines, in the order they were written
+		for _, line := range strings.Split(run.StdOut, "\n") {
+			i := strings.IndexAny(line, ":=")
+			if i <= 0 {
+				continue
+			}
+			key := strings.TrimSpace(line[:i])
+			if _, seen := values[key]; !seen {
+				order = append(order, key)
+			}
+			values[key] = strings.TrimSpace(line[i+1:])
+		}
+		if len(values) == 0 {
+			return Formatted{}, fmt.Errorf("fields needs a JSON object or key: value lines")
+		}
+	}
+	if len(output.Columns) > 0 || len(order) == 0 {
+		order = keys(values, output.Columns)
+	}
+
+	formatted := Formatted{Text: resultText(run, "")}
+	for _, key := range order {
+		value := cell(values[key])
+		formatted.Fields = append(formatted.Fields, Field{Title: key, Value: value, Short: len(value) <= shortFieldLength})
+	}
+	return formatted, nil
+}
+
+func validateRegex(output Output) error {
+	if output.Pattern == "" {
+		return fmt.Errorf("output format regex needs a pattern")
+	}
+	_, err := regexp.Compile(output.Pattern)
+	return err
+}
+
+func formatRegex(output Output, run Run) (Formatted, error) {
+	pattern, err := regexp.Compile(output.Pattern)
+	if err != nil {
+		return Formatted{}, err
+	}
+	summary := []string{}
+	for _, line := range strings.Split(run.StdOut+"\n"+run.StdError, "\n") {
+		match := pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		// with capture groups only the captured text is kept
+		if len(match) > 1 {
+			summary = append(summary, strings.TrimSpace(strings.Join(match[1:], " ")))
+		} else {
+			summary = append(summary, strings.TrimSpace(line))
+		}
+	}
+	body := "_No summary lines found_"
+	if len(summary) > 0 {
+		body = strings.Join(summary, "\n")
+	}
+	if run.ID != "" {
+		body += fmt.Sprintf("\n_Full output: `show %s`_", run.ID)
+	}
+	return Formatted{Text: "*ExitCode: " + strconv.Itoa(run.ReturnCode) + "*\n" + body}, nil
+}
+
+// templateFuncs are available in output templates
+var templateFuncs = template.FuncMap{
+	"json": func(text string) (interface{}, error) {
+		var value interface{}
+		err := json.Unmarshal([]byte(text), &value)
+		return value, err
+	},
+	"lines": func(text string) []string {
+		return strings.Split(strings.TrimRight(text, "\n"), "\n")
+	},
+	"trim": strings.TrimSpace,
+	"code": codeBlock,
+}
+
+func validateTemplate(output Output) error {
+	if output.Template == "" {
+		return fmt.Errorf("output format template needs a template")
+	}
+	_, err := template.New("output").Funcs(templateFuncs).Parse(output.Template)
+	return err
+}
+
+func formatTemplate(output Output, run Run) (Formatted, error) {
+	t, err := template.New("output").Funcs(templateFuncs).Parse(output.Template)
+	if err != nil {
+		return Formatted{}, err
+	}
+	var text bytes.Buffer
+	if err := t.Execute(&text, run); err != nil {
+		return Formatted{}, err
+	}
+	return Formatted{Text: text.String()}, nil
+}
+
+// keys returns the keys listed in columns, or all of them sorted
+func keys(values map[string]interface{}, columns []string) []string {
+	if len(columns) > 0 {
+		return columns
+	}
+	result := []string{}
+	for key := range values {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// cell turns a JSON value into text
+func cell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	default:
+		data, _ := marshalJSON(v, "")
+		return data
+	}
+}
+
+// textTable aligns the columns in a code block since Slack messages have no tables
+func textTable(header []string, rows [][]string) string {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i := 0; i < len(row) && i < len(widths); i++ {
+			if n := utf8.RuneCountInString(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	line := func(row []string) string {
+		cells := make([]string, len(widths))
+		for i := range widths {
+			value := ""
+			if i < len(row) {
+				value = row[i]
+			}
+			cells[i] = value + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value))
+		}
+		return strings.TrimRight(strings.Join(cells, "  "), " ")
+	}
+
+	lines := []string{line(header)}
+	separator := make([]string, len(widths))
+	for i, width := range widths {
+		separator[i] = strings.Repeat("-", width)
+	}
+	lines = append(lines, strings.Join(separator, "  "))
+	for _, row := range rows {
+		lines = append(lines, line(row))
+	}
+	return codeBlock(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,132 @@
+package slackchatops
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestOutputYAML(t *testing.T) {
+	var actions []Action
+	err := yaml.Unmarshal([]byte("- name: a\n  output: json\n- name: b\n  output:\n    format: regex\n    pattern: ^ok\n"), &actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions[0].Output.Format != FormatJSON || actions[1].Output.Format != FormatRegex || actions[1].Output.Pattern != "^ok" {
+		t.Errorf("unexpected outputs %+v %+v", actions[0].Output, actions[1].Output)
+	}
+}
+
+func TestFormatters(t *testing.T) {
+	tests := []struct {
+		output   Output
+		stdout   string
+		expected string
+	}{
+		{Output{Format: FormatCode}, "hello", "*ExitCode: 0*\n```hello```"},
+		{Output{Format: FormatJSON}, `{"a":[1,2]}`, "*ExitCode: 0*\n```{\n  \"a\": [\n    1,\n    2\n  ]\n}```"},
+		{Output{Format: FormatJSON}, `{"a":"x & <y>"}`, "*ExitCode: 0*\n```{\n  \"a\": \"x & <y>\"\n}```"},
+		{Output{Format: FormatJSONTable}, `[{"name":"api","tags":["a&b","<c>"]}]`, "*ExitCode: 0*\n```name  tags\n----  -------------\napi   [\"a&b\",\"<c>\"]```"},
+		{Output{Format: FormatJSONTable}, `[{"name":"api","up":true},{"name":"worker","up":false,"extra":{"n":1}}]`,
+			"*ExitCode: 0*\n```extra    name    up\n-------  ------  -----\n         api     true\n{\"n\":1}  worker  false```"},
+		{Output{Format: FormatJSONTable, Columns: []string{"up", "name"}}, `[{"name":"api","up":true}]`, "*ExitCode: 0*\n```up    name\n----  ----\ntrue  api```"},
+		{Output{Format: FormatCSVTable}, "host,load\nweb1,0.5\nweb22,1.25\n", "*ExitCode: 0*\n```host   load\n-----  ----\nweb1   0.5\nweb22  1.25```"},
+		{Output{Format: FormatCSVTable, Columns: []string{"load"}}, "host,load\nweb1,0.5\n", "*ExitCode: 0*\n```load\n----\n0.5```"},
+		{Output{Format: FormatRegex, Pattern: `^(PASS|FAIL)`}, "=== RUN a\nPASS\nok", "*ExitCode: 0*\nPASS\n_Full output: `show abc`_"},
+		{Output{Format: FormatTemplate, Template: `{{.Action}} {{with json .StdOut}}{{.version}}{{end}} ({{.ReturnCode}})`}, `{"version":"1.2"}`, "deploy 1.2 (0)"},
+	}
+	for _, test := range tests {
+		if err := test.output.Validate(); err != nil {
+			t.Errorf("%s: %v", test.output.Format, err)
+			continue
+		}
+		formatted, err := test.output.Render(Run{ID: "abc", Action: "deploy", StdOut: test.stdout})
+		if err != nil {
+			t.Errorf("%s: %v", test.output.Format, err)
+			continue
+		}
+		if formatted.Text != test.expected {
+			t.Errorf("%s: expected\n%s\nbut got\n%s", test.output.Format, test.expected, formatted.Text)
+		}
+	}
+}
+
+func TestFieldsFormatter(t *testing.T) {
+	output := Output{Format: FormatFields}
+	formatted, err := output.Render(Run{StdOut: "version: 1.2\nstatus=healthy\nnot a field\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(formatted.Fields) != 2 || formatted.Fields[0] != (Field{Title: "version", Value: "1.2", Short: true}) || formatted.Fields[1].Title != "status" {
+		t.Errorf("unexpected fields %+v", formatted.Fields)
+	}
+	formatted, _ = output.Render(Run{StdOut: `{"b":2,"a":"x"}`})
+	if len(formatted.Fields) != 2 || formatted.Fields[0].Title != "a" || formatted.Fields[1].Value != "2" {
+		t.Errorf("unexpected fields %+v", formatted.Fields)
+	}
+}
+
+func TestOutputValidate(t *testing.T) {
+	for _, output := range []Output{
+		{Format: "nope"},
+		{Format: FormatRegex},
+		{Format: FormatRegex, Pattern: "("},
+		{Format: FormatTemplate, Template: "{{.Missing"},
+	} {
+		if err := output.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", output)
+		}
+	}
+	a := Action{Name: "tail", Stream: true, Output: Output{Format: FormatJSON}}
+	if err := a.Validate(); err == nil {
+		t.Errorf("expected streaming actions not to accept an output format")
+	}
+}
+
+type upperFormatter struct{}
+
+func (upperFormatter) Validate(output Output) error { return nil }
+
+func (upperFormatter) Format(output Output, run Run) (Formatted, error) {
+	return Formatted{Text: strings.ToUpper(run.StdOut)}, nil
+}
+
+func TestBotFormatsOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	RegisterFormatter("upper", upperFormatter{})
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "shout", Command: "echo", Args: []string{"hello"}, Output: Output{Format: "upper"}},
+		{Name: "broken", Command: "echo", Args: []string{"not json"}, Output: Output{Format: FormatJSON}},
+		{Name: "tags", Command: "echo", Args: []string{`{"tags":"a & b <c>"}`}, Output: Output{Format: FormatJSON}},
+		{Name: "grep", Command: "echo", Args: []string{"a & b <c>"}, Output: Output{Format: FormatRegex, Pattern: `^a & b <(c)>$`}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "shout"}, response)
+	if text := response.text(); !strings.Contains(text, "HELLO") {
+		t.Errorf("expected registered formatter to be used but got %s", text)
+	}
+
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "broken"}, response)
+	if text := response.text(); !strings.Contains(text, "_Output:_\n```not json") {
+		t.Errorf("expected plain output when the formatter fails but got %s", text)
+	}
+
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "tags"}, response)
+	if text := response.text(); !strings.Contains(text, `"tags": "a &amp; b &lt;c&gt;"`) {
+		t.Errorf("expected the JSON to be parsed before it was escaped but got %s", text)
+	}
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "grep"}, response)
+	if text := response.text(); !strings.Contains(text, "*ExitCode: 0*\nc\n") {
+		t.Errorf("expected the pattern to match the unescaped output but got %s", text)
+	}
+}
@@ -0,0 +1,355 @@
+package slackchatops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// ErrBusy is returned when an exclusive action (or its lock group) is already running
+var ErrBusy = errors.New("Busy with another action")
+
+const (
+	streamTailLines       = 20
+	defaultStreamInterval = 3 * time.Second
+)
+
+// executor runs the command of an action once every check passed. replied is true when
+// the output was already posted while it ran
+type executor func(ctx context.Context, request *Request, args []string, response Responder) (result Result, replied bool, err error)
+
+// runnable is an action or workflow the bot can run
+type runnable struct {
+	action  Action
+	execute executor
+}
+
+// commandExecutor runs the action's command, streaming its output when the action asks for it
+func (b *Bot) commandExecutor(a Action, config *Config) executor {
+	return func(ctx context.Context, request *Request, args []string, response Responder) (Result, bool, error) {
+		if a.Stream {
+			result, err := b.streamRun(ctx, &a, args, response, config.StreamInterval)
+			return result, true, err
+		}
+		result, err := a.RunContext(ctx, args...)
+		return result, false, err
+	}
+}
+
+// actionHandler runs an action typed in chat: check permissions, split the arguments and run it
+func (b *Bot) actionHandler(r *runnable, s *setup) func(*Request, Responder) {
+	a := r.action
+	return func(request *Request, response Responder) {
+		if !s.permissions.Check(&a, request.User, request.Channel).Allowed {
+			response.Alert(AlertDanger, "You are not authorized to execute this action", "")
+			return
+		}
+
+		b.Log.WithFields(logrus.Fields{"command": a.Name}).Info("InHandler")
+		values, err := CommandArgs(request.Text, a.Name)
+		if err == nil && len(a.Params) > 0 && len(values) > len(a.Params) {
+			err = fmt.Errorf("Expected at most %d argument(s) but got %d. Wrap values containing spaces in quotes", len(a.Params), len(values))
+		}
+		if err != nil {
+			response.Alert(AlertDanger, "Invalid parameters for "+a.Name, err.Error())
+			return
+		}
+		b.runAction(r, s, request, values, response)
+	}
+}
+
+// RunAction runs an action with values already split into its params (ex: submitted with a
+// form) through the same permission, approval and locking steps as a typed command
+func (b *Bot) RunAction(ctx context.Context, message Message, name string, values []string, response Responder) {
+	b.mu.RLock()
+	s := b.setup
+	b.mu.RUnlock()
+	r, ok := s.runnables[name]
+	if !ok {
+		response.Alert(AlertWarning, "Unknown action", name)
+		return
+	}
+	if !s.permissions.Check(&r.action, message.User, message.Channel).Allowed {
+		response.Alert(AlertDanger, "You are not authorized to execute this action", "")
+		return
+	}
+	b.Log.WithFields(logrus.Fields{"command": name}).Info("InHandler")
+	b.runAction(r, s, &Request{Message: message, ctx: ctx}, values, response)
+}
+
+// runAction validates the values, asks for confirmation and approvals and then runs the action
+func (b *Bot) runAction(r *runnable, s *setup, request *Request, values []string, response Responder) {
+	a := r.action
+	// the command's message gets a thread with every reply unless the action posts to the channel
+	reply := response
+	if a.Replies != RepliesChannel {
+		reply = response.Thread()
+	}
+	values, err := a.ValidateParams(values)
+	if err != nil {
+		reply.Alert(AlertDanger, "Invalid parameters for "+a.Name, err.Error())
+		return
+	}
+	args := values
+
+	if a.Confirm.Enabled {
+		confirmation := b.Confirmations.Request(request.User)
+		text := fmt.Sprintf("%s This will run\n%s\n<@%s> reply `yes %s` within %s to run it or `no %s` to cancel",
+			a.Confirm.Question(), codeBlock(CommandLine(a.Command, a.ParseArgs(args))), request.User, confirmation.Token, b.Confirmations.Timeout, confirmation.Token)
+		reply.Buttons(text, []Button{
+			{Label: "Yes, run it", Command: "yes " + confirmation.Token, Style: "danger"},
+			{Label: "Cancel", Command: "no " + confirmation.Token},
+		})
+		switch confirmation.Wait(request.Context()) {
+		case nil:
+		case ErrDeclined:
+			reply.Reply(fmt.Sprintf("*`%s` cancelled*", a.Name))
+			return
+		default:
+			reply.Reply(fmt.Sprintf("*`%s` was not confirmed in time*", a.Name))
+			return
+		}
+		b.Log.WithFields(logrus.Fields{"command": a.Name, "user": request.User}).Info("Confirmed")
+	}
+
+	if a.RequiresApproval {
+		approval := b.Approvals.Request(&a, request.User, request.Channel, args)
+		reply.Reply(fmt.Sprintf("<@%s> wants to run `%s %s`. This needs %d approval(s) from %s within %s. Reply `approve %s` or `deny %s`",
+			approval.Requester, a.Name, strings.Join(args, " "), approval.Action.RequiredApprovals(), mentions(a.Approvers), b.Approvals.Timeout, approval.ID, approval.ID))
+		switch approval.Wait(request.Context()) {
+		case nil:
+			reply.Reply(fmt.Sprintf("Request `%s` approved by %s", approval.ID, mentions(approval.ApprovedBy())))
+		case ErrDenied:
+			reply.Reply(fmt.Sprintf("*Request `%s` denied by <@%s>*", approval.ID, approval.DeniedBy()))
+			return
+		default:
+			reply.Reply(fmt.Sprintf("*Request `%s` expired without enough approvals*", approval.ID))
+			return
+		}
+		b.Log.WithFields(logrus.Fields{"command": a.Name, "approval": approval.ID, "approvedBy": approval.ApprovedBy()}).Info("Approved")
+	}
+
+	var job *Job
+	result, _ := b.runJob(r, request, args, reply, func(j *Job) { job = j })
+	if job != nil && a.Replies != RepliesQuiet && reply != response && request.Thread == "" {
+		response.Reply(summary(&a, args, job, result))
+	}
+}
+
+// summary is the line posted to the channel once an action replying in a thread finished
+func summary(a *Action, args []string, job *Job, result Result) string {
+	emoji, status := ReactionSucceeded, "succeeded"
+	switch {
+	case result.Cancelled:
+		emoji, status = ReactionFailed, "was cancelled"
+	case result.TimedOut:
+		emoji, status = ReactionFailed, "timed out"
+	case result.ReturnCode != 0:
+		emoji, status = ReactionFailed, fmt.Sprintf("failed with exit code %d", result.ReturnCode)
+	}
+	return fmt.Sprintf(":%s: `%s` by %s %s after %s (job `%s`)", emoji, strings.TrimSpace(a.Name+" "+strings.Join(args, " ")),
+		mentions([]string{job.User}), status, time.Since(job.Started).Round(time.Second), job.ID)
+}
+
+// runJob waits for the action's lock, runs it as a job, records it to the history and replies with the result.
+// started is called with the job as soon as it has an id, before it waits in the queue. Optional
+func (b *Bot) runJob(r *runnable, request *Request, args []string, response Responder, started func(job *Job)) (Result, error) {
+	a := r.action
+	lockKey := a.LockKey()
+	if lockKey != "" && a.Concurrency != ConcurrencyQueue {
+		if !b.Locks.TryAcquire(lockKey) {
+			response.Reply("Busy with another action. Please wait...")
+			return Result{}, ErrBusy
+		}
+	}
+
+	job, ctx := b.Jobs.Start(request.Context(), &a, request.User, request.Channel)
+	defer b.Jobs.Finish(job)
+	if started != nil {
+		started(job)
+	}
+	// the reaction on the command shows the state of the job: queued, running, succeeded or failed
+	reaction := ""
+	react := func(emoji string) {
+		if a.NoReactions || emoji == reaction {
+			return
+		}
+		if reaction != "" {
+			response.Unreact(reaction)
+		}
+		reaction = emoji
+		if err := response.React(emoji); err != nil {
+			b.Log.WithFields(logrus.Fields{"command": a.Name, "job": job.ID}).Debug("Unable to react: ", err)
+		}
+	}
+	if lockKey != "" && a.Concurrency == ConcurrencyQueue {
+		err := b.Locks.Acquire(ctx, lockKey, func(position int) {
+			react(ReactionQueued)
+			response.Reply(fmt.Sprintf("Job `%s` queued at position %d (use `cancel %s` to remove it)", job.ID, position, job.ID))
+		})
+		if err != nil {
+			react(ReactionFailed)
+			response.Reply(fmt.Sprintf("*Job `%s` cancelled by <@%s> while queued*", job.ID, job.CancelledBy()))
+			return Result{Cancelled: true}, err
+		}
+	}
+	if lockKey != "" {
+		defer b.Locks.Release(lockKey)
+	}
+	react(ReactionRunning)
+
+	response.Reply(fmt.Sprintf("Started job `%s` (use `cancel %s` to stop it)", job.ID, job.ID))
+	b.Log.WithFields(logrus.Fields{"command": a.Name, "job": job.ID, "user": job.User}).Info("JobStarted")
+	response.Typing()
+	b.Log.WithFields(logrus.Fields{"command": a.Name, "args": args}).Debug("Args")
+	result, replied, err := r.execute(ctx, request, args, response)
+	run := NewRun(job, args, result)
+	if failed(result, err) {
+		react(ReactionFailed)
+	} else {
+		react(ReactionSucceeded)
+	}
+	if herr := b.History.Add(run); herr != nil {
+		b.Log.WithFields(logrus.Fields{"command": a.Name, "job": job.ID}).Error(herr)
+	}
+
+	if result.Cancelled {
+		response.Reply(fmt.Sprintf("*Job `%s` cancelled by <@%s>*", job.ID, job.CancelledBy()))
+	}
+	if result.TimedOut {
+		response.Reply("*Timed out after " + a.Timeout.String() + "*")
+		b.Log.WithFields(logrus.Fields{"command": a.Name, "timeout": a.Timeout}).Warn("TimedOut")
+	}
+	if !replied {
+		b.replyResult(&a, run, err, response)
+	}
+
+	b.uploadOutputFiles(&a, job, response)
+	return result, err
+}
+
+// replyResult posts the exit code and output of a finished run, formatted as the action's Output asks.
+// When the formatter fails (ex: the output isn't JSON) or its message is too long the plain output is posted instead
+func (b *Bot) replyResult(a *Action, run Run, err error, response Responder) {
+	if a.Output.Format != "" {
+		// formatters parse the output as the command wrote it, only their message is escaped for Slack
+		clean := run
+		clean.StdOut, clean.StdError = stripANSI(run.StdOut), stripANSI(run.StdError)
+		formatted, ferr := a.Output.Render(clean)
+		formatted = formatted.escape()
+		switch {
+		case ferr != nil:
+			b.Log.WithFields(logrus.Fields{"command": a.Name, "format": a.Output.Format}).Warn("Unable to format output: ", ferr)
+		case isLong(formatted.Text, b.Config().inlineLines(a)+formattedExtraLines):
+		case len(formatted.Fields) == 0:
+			response.Reply(formatted.Text)
+			return
+		default:
+			color := AlertGood
+			if run.ReturnCode != 0 || run.TimedOut || run.Cancelled {
+				color = AlertDanger
+			}
+			response.Fields(color, formatted.Text, formatted.Fields)
+			return
+		}
+	}
+
+	response.Reply("*ExitCode: " + strconv.Itoa(run.ReturnCode) + "*")
+	b.replyOutput(a, run, err != nil, response)
+}
+
+// streamRun runs the action while periodically editing a single message with the
+// tail of its output. Updates are throttled to interval to respect rate limits
+func (b *Bot) streamRun(ctx context.Context, a *Action, args []string, response Responder, interval time.Duration) (Result, error) {
+	if interval <= 0 {
+		interval = defaultStreamInterval
+	}
+	id, err := response.Reply(fmt.Sprintf("_Running %s..._", a.Name))
+	if err != nil {
+		// can't edit a message we couldn't post so fall back to replying once finished
+		b.Log.WithFields(logrus.Fields{"command": a.Name}).Debug("Unable to post stream message: ", err)
+		result, err := a.RunContext(ctx, args...)
+		response.Reply("*ExitCode: " + strconv.Itoa(result.ReturnCode) + "*\n" + codeBlock(cleanOutput(result.StdOut+result.StdError)))
+		return result, err
+	}
+
+	var result Result
+	var runErr error
+	lines := make(chan string, 100)
+	done := make(chan struct{})
+	go func() {
+		result, runErr = a.RunStream(ctx, lines, args...)
+		close(done)
+	}()
+
+	tail := NewTail(streamTailLines)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changed := false
+	for lines != nil {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil
+				continue
+			}
+			tail.Add(line)
+			changed = true
+		case <-ticker.C:
+			if changed {
+				response.Edit(id, fmt.Sprintf("_Running %s..._\n%s", a.Name, formatTail(tail, a.masker)))
+				changed = false
+			}
+		}
+	}
+	<-done
+
+	if tail.Total() == 0 && result.StdError != "" {
+		tail.Add(result.StdError)
+	}
+	response.Edit(id, fmt.Sprintf("%s\n*ExitCode: %d*", formatTail(tail, a.masker), result.ReturnCode))
+	return result, runErr
+}
+
+// formatTail shows the lines held by the tail. They are masked together so secrets spanning
+// several lines are hidden too
+func formatTail(tail *Tail, masker *masker) string {
+	if tail.Total() == 0 {
+		return "_No output_"
+	}
+	text := codeBlock(cleanOutput(masker.Mask(tail.String())))
+	if skipped := tail.Total() - len(tail.Lines()); skipped > 0 {
+		text = fmt.Sprintf("_... %d earlier lines_\n", skipped) + text
+	}
+	return text
+}
+
+func codeBlock(text string) string {
+	return "```" + text + "```"
+}
+
+// reportError replies with an error the same way for every command
+func reportError(response Responder, err error) {
+	response.Reply(fmt.Sprintf("*Error:* _%s_", err.Error()))
+}
+
+// mentions formats slackIds and user group ids so Slack renders them as names
+func mentions(ids []string) string {
+	result := []string{}
+	for _, id := range ids {
+		switch {
+		case IsUserGroupID(id):
+			result = append(result, "<!subteam^"+id+">")
+		case isSlackID(id):
+			result = append(result, "<@"+id+">")
+		default:
+			result = append(result, "`"+id+"`")
+		}
+	}
+	return strings.Join(result, ", ")
+}
@@ -0,0 +1,207 @@
+package slackchatops
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// otherCategory groups the actions without a Category once some actions have one
+const otherCategory = "Other"
+
+// usage returns how the action is typed. Params with a default may be left out and are shown in brackets
+func (a *Action) usage() string {
+	usage := a.Name
+	for _, p := range a.Params {
+		if p.Default != "" {
+			usage += " [" + p.Name + "]"
+		} else {
+			usage += " <" + p.Name + ">"
+		}
+	}
+	return usage
+}
+
+// describe explains what values the param accepts
+func (p Param) describe() string {
+	kind := p.Type
+	if kind == "" {
+		kind = ParamString
+	}
+	switch {
+	case p.Type == ParamEnum:
+		kind += " (" + strings.Join(p.Choices, ", ") + ")"
+	case p.Min != "" && p.Max != "":
+		kind += " from " + p.Min + " to " + p.Max
+	case p.Min != "":
+		kind += " of at least " + p.Min
+	case p.Max != "":
+		kind += " of at most " + p.Max
+	}
+	if p.Pattern != "" {
+		kind += " matching `" + p.Pattern + "`"
+	}
+	if p.Default != "" {
+		return kind + ", default `" + p.Default + "`"
+	}
+	return kind + ", required"
+}
+
+// helpHandler lists the actions the user can run in the channel grouped by category, followed by
+// the built in commands. `help <action>` shows the details of one action instead
+func (b *Bot) helpHandler(request *Request, response Responder) {
+	if name := strings.TrimSpace(request.Param("action")); name != "" {
+		b.actionHelp(name, request, response)
+		return
+	}
+
+	b.mu.RLock()
+	s := b.setup
+	builtins := b.builtins
+	b.mu.RUnlock()
+
+	actions := []*Action{}
+	for i := range s.config.Actions {
+		actions = append(actions, &s.config.Actions[i])
+	}
+	for i := range s.config.Workflows {
+		actions = append(actions, &s.config.Workflows[i].Action)
+	}
+	categories := map[string][]string{}
+	for _, a := range actions {
+		if !s.permissions.Check(a, request.User, request.Channel).Allowed {
+			continue
+		}
+		line := "• `" + a.usage() + "`"
+		if a.Description != "" {
+			line += " - " + a.Description
+		}
+		categories[a.Category] = append(categories[a.Category], line)
+	}
+
+	names := []string{}
+	for name := range categories {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(categories[""]) > 0 {
+		names = append(names, "")
+	}
+
+	message := ""
+	if len(names) == 0 {
+		message += "_You can't run any action here_\n"
+	}
+	for _, name := range names {
+		switch {
+		case name != "":
+			message += "*" + name + "*\n"
+		case len(names) > 1:
+			message += "*" + otherCategory + "*\n"
+		default:
+			message += "*Actions*\n"
+		}
+		message += strings.Join(categories[name], "\n") + "\n"
+	}
+
+	message += "*Commands*\n"
+	for _, command := range builtins {
+		message += "• `" + command.Usage + "` - " + command.Description + "\n"
+	}
+	message += "_Use `help <action>` for the parameters, examples and permissions of an action_"
+	response.Reply(message)
+}
+
+// actionHelp shows everything about one action: its help text, params, examples, who may run
+// it and how its latest run went
+func (b *Bot) actionHelp(name string, request *Request, response Responder) {
+	a := b.FindAction(name)
+	if a == nil {
+		b.mu.RLock()
+		builtins := b.builtins
+		b.mu.RUnlock()
+		for _, command := range builtins {
+			if command.Tokenize()[0].Word == name {
+				response.Reply(fmt.Sprintf("`%s` - %s", command.Usage, command.Description))
+				return
+			}
+		}
+		reportError(response, fmt.Errorf("Unknown action %s", name))
+		return
+	}
+
+	message := "*" + a.Name + "*"
+	if a.Category != "" {
+		message += " (" + a.Category + ")"
+	}
+	if a.Description != "" {
+		message += " - " + a.Description
+	}
+	message += "\n"
+	if a.Help != "" {
+		message += strings.TrimSpace(a.Help) + "\n"
+	}
+	message += "*Usage:* `" + a.usage() + "`\n"
+	if len(a.Params) > 0 {
+		message += "*Parameters:*\n"
+		for _, p := range a.Params {
+			message += "• `" + p.Name + "` " + p.describe() + "\n"
+		}
+	}
+	if len(a.Usage) > 0 {
+		message += "*Examples:*\n"
+		for _, example := range a.Usage {
+			message += "• `" + example + "`\n"
+		}
+	}
+
+	message += "*Permissions:* " + permissionsSummary(a) + "\n"
+	decision := b.Permissions().Check(a, request.User, request.Channel)
+	if decision.Allowed {
+		message += fmt.Sprintf("You can run it here (%s)\n", decision.Reason)
+	} else {
+		message += fmt.Sprintf("You can't run it here (%s)\n", decision.Reason)
+	}
+
+	if runs := b.History.Recent(a.Name, 1); len(runs) > 0 {
+		run := runs[0]
+		message += fmt.Sprintf("*Last run:* `%s` by %s at %s - %s (%s)", run.ID, mentions([]string{run.User}), run.Started.Format(timeFormat), runStatus(run), run.Duration().Round(time.Second))
+	} else {
+		message += "*Last run:* _never_"
+	}
+	response.Reply(message)
+}
+
+// permissionsSummary lists who may run the action and what has to happen before it runs
+func permissionsSummary(a *Action) string {
+	parts := []string{}
+	allowed := []string{}
+	for _, u := range a.AuthorizedUsers {
+		allowed = append(allowed, mentions([]string{u}))
+	}
+	for _, rule := range a.Allow {
+		allowed = append(allowed, rule.String())
+	}
+	if len(allowed) == 0 {
+		parts = append(parts, "everyone")
+	} else {
+		parts = append(parts, "allowed for "+strings.Join(allowed, ", "))
+	}
+	if len(a.Deny) > 0 {
+		denied := []string{}
+		for _, rule := range a.Deny {
+			denied = append(denied, rule.String())
+		}
+		parts = append(parts, "denied for "+strings.Join(denied, ", "))
+	}
+	if a.Confirm.Enabled {
+		parts = append(parts, "needs confirmation")
+	}
+	if a.RequiresApproval {
+		parts = append(parts, fmt.Sprintf("needs %d approval(s) from %s", a.RequiredApprovals(), mentions(a.Approvers)))
+	}
+	return strings.Join(parts, ", ")
+}
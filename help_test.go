@@ -0,0 +1,63 @@
+package slackchatops
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHelpGroupsAuthorizedActions(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "deploy", Command: "echo", Args: []string{"{0}"}, Description: "Deploy it", Category: "Release", Params: []Param{{Name: "version"}}},
+		{Name: "rollback", Command: "echo", Category: "Release", AuthorizedUsers: []string{"U2"}},
+		{Name: "uptime", Command: "uptime"},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "help"}, response)
+	text := response.text()
+	if !strings.Contains(text, "*Release*\n• `deploy <version>` - Deploy it\n*Other*\n• `uptime`\n*Commands*") {
+		t.Errorf("expected actions grouped by category but got %s", text)
+	}
+	if strings.Contains(text, "rollback") {
+		t.Errorf("expected rollback to be hidden from U1 but got %s", text)
+	}
+}
+
+func TestHelpShowsActionDetails(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{
+		{Name: "deploy", Command: "echo", Args: []string{"{0}", "{1}"}, Description: "Deploy it", Category: "Release",
+			Help: "Deploys the version to the environment.", Usage: []string{"deploy 1.4.2 prod"},
+			Params: []Param{
+				{Name: "version", Type: ParamSemver},
+				{Name: "env", Type: ParamEnum, Choices: []string{"staging", "prod"}, Default: "staging"},
+			},
+			Allow: []Rule{{Who: "U1"}}, RequiresApproval: true, Approvers: []string{"U9"}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "help deploy"}, response)
+	text := response.text()
+	for _, expected := range []string{
+		"*deploy* (Release) - Deploy it\nDeploys the version to the environment.",
+		"*Usage:* `deploy <version> [env]`",
+		"• `version` semver, required",
+		"• `env` enum (staging, prod), default `staging`",
+		"*Examples:*\n• `deploy 1.4.2 prod`",
+		"*Permissions:* allowed for U1, needs 1 approval(s) from <@U9>",
+		"You can run it here",
+		"*Last run:* _never_",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected help to contain %q but got %s", expected, text)
+		}
+	}
+
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "help nope"}, response)
+	if text := response.text(); !strings.Contains(text, "Unknown action nope") {
+		t.Errorf("expected unknown action but got %s", text)
+	}
+}
@@ -0,0 +1,191 @@
+package slackchatops
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Run is a single recorded execution of an action
+type Run struct {
+	ID          string
+	Action      string
+	User        string
+	Channel     string
+	Args        []string
+	Started     time.Time
+	Finished    time.Time
+	ReturnCode  int
+	TimedOut    bool
+	Cancelled   bool
+	CancelledBy string
+	StdOut      string
+	StdError    string
+}
+
+// Duration returns how long the run took
+func (r Run) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// NewRun records the outcome of a job
+func NewRun(job *Job, args []string, result Result) Run {
+	return Run{
+		ID:          job.ID,
+		Action:      job.Action.Name,
+		User:        job.User,
+		Channel:     job.Channel,
+		Args:        args,
+		Started:     job.Started,
+		Finished:    time.Now(),
+		ReturnCode:  result.ReturnCode,
+		TimedOut:    result.TimedOut,
+		Cancelled:   result.Cancelled,
+		CancelledBy: job.CancelledBy(),
+		StdOut:      result.StdOut,
+		StdError:    result.StdError,
+	}
+}
+
+// History persists runs to a local file with one JSON document per line.
+// Runs older than MaxAge or beyond the newest MaxRuns are pruned
+type History struct {
+	MaxAge  time.Duration // zero keeps runs forever
+	MaxRuns int           // zero keeps any number of runs
+
+	mu   sync.Mutex
+	path string
+	runs []Run
+}
+
+// OpenHistory loads the history stored at path. The file is created on the first Add if it doesn't exist
+func OpenHistory(path string, maxAge time.Duration, maxRuns int) (*History, error) {
+	h := &History{MaxAge: maxAge, MaxRuns: maxRuns, path: path}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			continue // skip a partially written line rather than losing everything
+		}
+		h.runs = append(h.runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if h.prune() {
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Add records a run and applies the retention policy
+func (h *History) Add(run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = append(h.runs, run)
+	if h.prune() {
+		return h.rewrite()
+	}
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Get returns the run with the given id
+func (h *History) Get(id string) (Run, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		if h.runs[i].ID == id {
+			return h.runs[i], true
+		}
+	}
+	return Run{}, false
+}
+
+// Recent returns up to n of the latest runs, newest first. When action is not empty
+// only runs of that action are returned
+func (h *History) Recent(action string, n int) []Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := []Run{}
+	for i := len(h.runs) - 1; i >= 0 && len(result) < n; i-- {
+		if action == "" || h.runs[i].Action == action {
+			result = append(result, h.runs[i])
+		}
+	}
+	return result
+}
+
+// prune drops runs outside of the retention policy and reports whether anything was removed
+func (h *History) prune() bool {
+	keep := h.runs
+	if h.MaxAge > 0 {
+		cutoff := time.Now().Add(-h.MaxAge)
+		i := 0
+		for i < len(keep) && keep[i].Finished.Before(cutoff) {
+			i++
+		}
+		keep = keep[i:]
+	}
+	if h.MaxRuns > 0 && len(keep) > h.MaxRuns {
+		keep = keep[len(keep)-h.MaxRuns:]
+	}
+	if len(keep) == len(h.runs) {
+		return false
+	}
+	h.runs = append([]Run{}, keep...)
+	return true
+}
+
+// rewrite replaces the file with the current runs. A temp file is renamed over the
+// original so a crash never leaves a half written history behind
+func (h *History) rewrite() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(h.path), filepath.Base(h.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, run := range h.runs {
+		if err = enc.Encode(run); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), h.path)
+}
@@ -0,0 +1,58 @@
+package slackchatops
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHistoryPersists(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	history, err := OpenHistory(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history.Add(Run{ID: "a1", Action: "deploy", StdOut: "done", Finished: time.Now()})
+	history.Add(Run{ID: "b2", Action: "ls", Finished: time.Now()})
+
+	history, err = OpenHistory(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, ok := history.Get("a1")
+	if !ok || run.StdOut != "done" {
+		t.Error("Run was not persisted")
+	}
+	if runs := history.Recent("deploy", 10); len(runs) != 1 || runs[0].ID != "a1" {
+		t.Error("Recent did not filter by action")
+	}
+	if runs := history.Recent("", 10); len(runs) != 2 || runs[0].ID != "b2" {
+		t.Error("Recent is not newest first")
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	history, _ := OpenHistory(path, time.Hour, 3)
+	history.Add(Run{ID: "old", Finished: time.Now().Add(-2 * time.Hour)})
+	for i := 0; i < 4; i++ {
+		history.Add(Run{ID: strconv.Itoa(i), Finished: time.Now()})
+	}
+
+	history, _ = OpenHistory(path, time.Hour, 3)
+	if _, ok := history.Get("old"); ok {
+		t.Error("Expired run was not removed")
+	}
+	if runs := history.Recent("", 10); len(runs) != 3 || runs[2].ID != "1" {
+		t.Errorf("Expected only the latest 3 runs to be kept but got %v", runs)
+	}
+}
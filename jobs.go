@@ -0,0 +1,111 @@
+package slackchatops
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job represents a single running invocation of an Action
+type Job struct {
+	ID      string    // short identifier announced in the channel. Used to cancel the job
+	Action  *Action   // action being executed
+	User    string    // slackId of the user that started the job
+	Channel string    // channel the job was started from
+	Started time.Time // when the job was started
+
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+	cancelledBy string
+}
+
+// CancelledBy returns the slackId of the user that cancelled the job, if any
+func (j *Job) CancelledBy() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.cancelledBy
+}
+
+// Jobs is a registry of all in-flight jobs
+type Jobs struct {
+	Used func(id string) bool // reports ids kept elsewhere (ex: the history) so they aren't given out again. Optional
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobs creates an empty job registry
+func NewJobs() *Jobs {
+	return &Jobs{jobs: map[string]*Job{}}
+}
+
+// Start registers a new job for the action. The returned context should be passed to
+// Action.RunContext and is cancelled when the job is cancelled
+func (j *Jobs) Start(ctx context.Context, a *Action, user string, channel string) (*Job, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	job := &Job{Action: a, User: user, Channel: channel, Started: time.Now(), cancel: cancel}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for {
+		job.ID = newJobID()
+		if _, exists := j.jobs[job.ID]; !exists && (j.Used == nil || !j.Used(job.ID)) {
+			break
+		}
+	}
+	j.jobs[job.ID] = job
+	return job, ctx
+}
+
+// Finish removes the job from the registry once the action has completed
+func (j *Jobs) Finish(job *Job) {
+	j.mu.Lock()
+	delete(j.jobs, job.ID)
+	j.mu.Unlock()
+	job.cancel()
+}
+
+// Get returns the in-flight job with the given id
+func (j *Jobs) Get(id string) (*Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	return job, ok
+}
+
+// List returns all in-flight jobs ordered by start time
+func (j *Jobs) List() []*Job {
+	j.mu.Lock()
+	result := make([]*Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		result = append(result, job)
+	}
+	j.mu.Unlock()
+	sort.Slice(result, func(a, b int) bool { return result[a].Started.Before(result[b].Started) })
+	return result
+}
+
+// Cancel stops the job with the given id and records who cancelled it
+func (j *Jobs) Cancel(id string, user string) error {
+	job, ok := j.Get(id)
+	if !ok {
+		return fmt.Errorf("No running job with id %s", id)
+	}
+	job.mu.Lock()
+	if job.cancelledBy == "" {
+		job.cancelledBy = user
+	}
+	job.mu.Unlock()
+	job.cancel()
+	return nil
+}
+
+func newJobID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,60 @@
+package slackchatops
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCancelJob(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	jobs := NewJobs()
+	action := Action{Name: "Foo", Command: "sh", Args: []string{"-c", "sleep 5"}}
+	job, ctx := jobs.Start(context.Background(), &action, "U1", "C1")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		if err := jobs.Cancel(job.ID, "U2"); err != nil {
+			t.Error(err)
+		}
+	}()
+	result, _ := action.RunContext(ctx)
+	jobs.Finish(job)
+
+	if !result.Cancelled {
+		t.Error("Expected job to be cancelled")
+	}
+	if job.CancelledBy() != "U2" {
+		t.Error("Expected job to be cancelled by U2")
+	}
+	if _, ok := jobs.Get(job.ID); ok {
+		t.Error("Finished job is still registered")
+	}
+}
+
+func TestCancelUnknownJob(t *testing.T) {
+	jobs := NewJobs()
+	if err := jobs.Cancel("nope", "U1"); err == nil {
+		t.Error("Expected error cancelling unknown job")
+	}
+}
+
+func TestJobIDsSkipUsedIDs(t *testing.T) {
+	jobs := NewJobs()
+	used := map[string]bool{}
+	jobs.Used = func(id string) bool {
+		if len(used) < 2 {
+			used[id] = true
+			return true
+		}
+		return used[id]
+	}
+	job, _ := jobs.Start(context.Background(), &Action{Name: "Foo"}, "U1", "C1")
+	defer jobs.Finish(job)
+	if len(used) != 2 || used[job.ID] {
+		t.Errorf("expected an id that wasn't used before but got %s (used %v)", job.ID, used)
+	}
+}
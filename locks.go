@@ -0,0 +1,95 @@
+package slackchatops
+
+import (
+	"context"
+	"sync"
+)
+
+// Locks hands out named locks used to control how many instances of an action run at once.
+// Waiters are served in the order they asked for the lock
+type Locks struct {
+	mu      sync.Mutex
+	held    map[string]bool
+	waiting map[string][]chan struct{}
+}
+
+// NewLocks creates an empty set of locks
+func NewLocks() *Locks {
+	return &Locks{held: map[string]bool{}, waiting: map[string][]chan struct{}{}}
+}
+
+// TryAcquire takes the lock if it is free and returns false otherwise
+func (l *Locks) TryAcquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[key] {
+		return false
+	}
+	l.held[key] = true
+	return true
+}
+
+// Acquire blocks until the lock is taken or the context is done. When the lock is busy
+// queued is called with the caller's position in the queue (1 being next in line)
+func (l *Locks) Acquire(ctx context.Context, key string, queued func(position int)) error {
+	l.mu.Lock()
+	if !l.held[key] {
+		l.held[key] = true
+		l.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	l.waiting[key] = append(l.waiting[key], ready)
+	position := len(l.waiting[key])
+	l.mu.Unlock()
+
+	if queued != nil {
+		queued(position)
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		removed := l.remove(key, ready)
+		l.mu.Unlock()
+		if !removed {
+			// the lock was handed to us while giving up so pass it on
+			l.Release(key)
+		}
+		return ctx.Err()
+	}
+}
+
+// Release frees the lock, handing it directly to the next waiter if there is one
+func (l *Locks) Release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if queue := l.waiting[key]; len(queue) > 0 {
+		next := queue[0]
+		l.waiting[key] = queue[1:]
+		close(next)
+		return
+	}
+	delete(l.waiting, key)
+	delete(l.held, key)
+}
+
+// Queued returns the number of callers waiting for the lock
+func (l *Locks) Queued(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiting[key])
+}
+
+func (l *Locks) remove(key string, ready chan struct{}) bool {
+	queue := l.waiting[key]
+	for i, c := range queue {
+		if c == ready {
+			l.waiting[key] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
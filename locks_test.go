@@ -0,0 +1,59 @@
+package slackchatops
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTryAcquire(t *testing.T) {
+	locks := NewLocks()
+	if !locks.TryAcquire("a") {
+		t.Error("Expected free lock to be acquired")
+	}
+	if locks.TryAcquire("a") {
+		t.Error("Expected held lock to be refused")
+	}
+	if !locks.TryAcquire("b") {
+		t.Error("Expected other lock to be acquired")
+	}
+	locks.Release("a")
+	if !locks.TryAcquire("a") {
+		t.Error("Expected released lock to be acquired")
+	}
+}
+
+func TestAcquireQueuesInOrder(t *testing.T) {
+	locks := NewLocks()
+	locks.TryAcquire("a")
+
+	positions := make(chan int, 2)
+	order := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		go func(i int) {
+			locks.Acquire(context.Background(), "a", func(p int) { positions <- p })
+			order <- i
+			locks.Release("a")
+		}(i)
+		if p := <-positions; p != i {
+			t.Errorf("Expected queue position %d but got %d", i, p)
+		}
+	}
+	locks.Release("a")
+	if first, second := <-order, <-order; first != 1 || second != 2 {
+		t.Error("Queued callers were not served in order")
+	}
+}
+
+func TestAcquireCancelledWhileQueued(t *testing.T) {
+	locks := NewLocks()
+	locks.TryAcquire("a")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := locks.Acquire(ctx, "a", nil); err == nil {
+		t.Error("Expected cancelled acquire to fail")
+	}
+	if locks.Queued("a") != 0 {
+		t.Error("Cancelled caller is still queued")
+	}
+}
@@ -0,0 +1,260 @@
+package slackchatops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	logrus "github.com/sirupsen/logrus"
+)
+
+const (
+	buttonCallbackID = "chatops_command"
+	formCallbackID   = "chatops_run"
+	maxTitleLength   = 24
+)
+
+// formMetadata is kept in the modal so the submission knows what to run where
+type formMetadata struct {
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+}
+
+// ParamsView builds a Slack modal with one field per param of the action. Enum and bool
+// params become dropdowns and defaults are filled in
+func ParamsView(a *Action, channel string) map[string]interface{} {
+	metadata, _ := json.Marshal(formMetadata{Action: a.Name, Channel: channel})
+	title := "Run " + a.Name
+	if len(title) > maxTitleLength {
+		title = title[:maxTitleLength-3] + "..."
+	}
+
+	blocks := []interface{}{}
+	for i, p := range a.Params {
+		var element map[string]interface{}
+		choices := p.Choices
+		if p.Type == ParamBool {
+			choices = []string{"true", "false"}
+		}
+		if len(choices) > 0 {
+			options := []interface{}{}
+			for _, c := range choices {
+				options = append(options, option(c))
+			}
+			element = map[string]interface{}{"type": "static_select", "action_id": "value", "options": options}
+			if p.Default != "" {
+				element["initial_option"] = option(p.Default)
+			}
+		} else {
+			element = map[string]interface{}{"type": "plain_text_input", "action_id": "value"}
+			if p.Default != "" {
+				element["initial_value"] = p.Default
+			}
+		}
+
+		block := map[string]interface{}{
+			"type":     "input",
+			"block_id": fmt.Sprintf("param_%d", i),
+			"label":    plainText(p.Name),
+			"element":  element,
+			"optional": p.Default != "",
+		}
+		if hint := paramHint(p); hint != "" {
+			block["hint"] = plainText(hint)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return map[string]interface{}{
+		"type":             "modal",
+		"callback_id":      formCallbackID,
+		"title":            plainText(title),
+		"submit":           plainText("Run"),
+		"close":            plainText("Cancel"),
+		"private_metadata": string(metadata),
+		"blocks":           blocks,
+	}
+}
+
+// paramHint describes what a param accepts
+func paramHint(p Param) string {
+	hint := p.Type
+	switch {
+	case p.Type == ParamEnum || p.Type == ParamBool:
+		return ""
+	case p.Type == "" && p.Pattern == "":
+		return ""
+	case p.Type == "":
+		hint = ParamString
+	}
+	if p.Pattern != "" {
+		hint += " matching " + p.Pattern
+	}
+	if p.Min != "" {
+		hint += ", at least " + p.Min
+	}
+	if p.Max != "" {
+		hint += ", at most " + p.Max
+	}
+	return hint
+}
+
+func plainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text}
+}
+
+func option(value string) map[string]interface{} {
+	return map[string]interface{}{"text": plainText(value), "value": value}
+}
+
+// OpenView shows a modal to the user that triggered it. The vendored Slack client predates
+// modals so views.open is called directly
+func OpenView(apiURL string, token string, trigger string, view map[string]interface{}) error {
+	if apiURL == "" {
+		apiURL = slack.SLACK_API
+	}
+	body, err := json.Marshal(map[string]interface{}{"trigger_id": trigger, "view": view})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", apiURL+"views.open", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("views.open failed: %s", result.Error)
+	}
+	return nil
+}
+
+// interaction is the part of a Slack interaction payload the bot uses
+type interaction struct {
+	Type       string `json:"type"`
+	CallbackID string `json:"callback_id"`
+	TriggerID  string `json:"trigger_id"`
+	User       struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Actions []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"actions"`
+	View struct {
+		CallbackID      string `json:"callback_id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
+			Values map[string]map[string]struct {
+				Value          string `json:"value"`
+				SelectedOption struct {
+					Value string `json:"value"`
+				} `json:"selected_option"`
+			} `json:"values"`
+		} `json:"state"`
+	} `json:"view"`
+}
+
+// InteractionHandler receives button clicks and form submissions from Slack
+type InteractionHandler struct {
+	SigningSecret string
+	Bot           *Bot
+	Client        *slack.Client
+}
+
+// ServeHTTP verifies the request and dispatches the interaction
+func (h *InteractionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := VerifySignature(h.SigningSecret, r.Header, body, time.Now()); err != nil {
+		h.Bot.Log.WithFields(logrus.Fields{"remote": r.RemoteAddr}).Warn(err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var payload interaction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case payload.Type == "interactive_message" && payload.CallbackID == buttonCallbackID && len(payload.Actions) > 0:
+		// a button is the same as typing its command
+		message := Message{User: payload.User.ID, Channel: payload.Channel.ID, Text: payload.Actions[0].Value, Trigger: payload.TriggerID}
+		go h.Bot.Handle(context.Background(), message, NewSlackResponder(h.Client, message.Channel))
+	case payload.Type == "view_submission" && payload.View.CallbackID == formCallbackID:
+		h.submit(w, payload)
+	}
+}
+
+// submit checks the values of a params form. Problems are shown next to the fields so the
+// user can fix them, otherwise the form closes and the action runs
+func (h *InteractionHandler) submit(w http.ResponseWriter, payload interaction) {
+	var metadata formMetadata
+	if err := json.Unmarshal([]byte(payload.View.PrivateMetadata), &metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a := h.Bot.FindAction(metadata.Action)
+	if a == nil {
+		http.Error(w, "Unknown action "+metadata.Action, http.StatusBadRequest)
+		return
+	}
+
+	values := make([]string, len(a.Params))
+	problems := map[string]string{}
+	for i, p := range a.Params {
+		blockID := fmt.Sprintf("param_%d", i)
+		field := payload.View.State.Values[blockID]["value"]
+		values[i] = strings.TrimSpace(field.Value)
+		if values[i] == "" {
+			values[i] = field.SelectedOption.Value
+		}
+		value := values[i]
+		if value == "" {
+			value = p.Default
+		}
+		if err := p.Check(value); err != nil {
+			problems[blockID] = strings.Replace(err.Error(), "`", "", -1)
+		}
+	}
+	if len(problems) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"response_action": "errors", "errors": problems})
+		return
+	}
+
+	message := Message{User: payload.User.ID, Channel: metadata.Channel}
+	go h.Bot.RunAction(context.Background(), message, a.Name, values, NewSlackResponder(h.Client, metadata.Channel))
+}
@@ -0,0 +1,126 @@
+package slackchatops
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var deployAction = Action{Name: "deploy", Command: "echo", Args: []string{"{0}", "{1}"}, Params: []Param{
+	{Name: "env", Type: ParamEnum, Choices: []string{"dev", "prod"}, Default: "dev"},
+	{Name: "version", Type: ParamSemver},
+}}
+
+func TestParamsView(t *testing.T) {
+	view := ParamsView(&deployAction, "C1")
+	blocks := view["blocks"].([]interface{})
+	if len(blocks) != 2 {
+		t.Fatalf("expected a block per param but got %d", len(blocks))
+	}
+	env := blocks[0].(map[string]interface{})
+	element := env["element"].(map[string]interface{})
+	if element["type"] != "static_select" || len(element["options"].([]interface{})) != 2 || element["initial_option"] == nil || env["optional"] != true {
+		t.Errorf("expected optional dropdown with default for enum but got %v", env)
+	}
+	version := blocks[1].(map[string]interface{})
+	if version["element"].(map[string]interface{})["type"] != "plain_text_input" || version["optional"] != false || version["hint"] == nil {
+		t.Errorf("expected required text field with hint for semver but got %v", version)
+	}
+	if view["private_metadata"] != `{"action":"deploy","channel":"C1"}` {
+		t.Errorf("unexpected metadata %v", view["private_metadata"])
+	}
+}
+
+func interactionRequest(payload string) *http.Request {
+	return signedRequest("secret", url.Values{"payload": {payload}}.Encode(), time.Now())
+}
+
+func TestFormSubmissionShowsProblems(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{deployAction}})
+	defer cleanup()
+	handler := &InteractionHandler{SigningSecret: "secret", Bot: bot}
+
+	payload := `{"type":"view_submission","user":{"id":"U1"},"view":{"callback_id":"chatops_run","private_metadata":"{\"action\":\"deploy\",\"channel\":\"C1\"}",
+		"state":{"values":{"param_0":{"value":{"selected_option":{"value":"prod"}}},"param_1":{"value":{"value":"latest"}}}}}}`
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, interactionRequest(payload))
+
+	var response struct {
+		ResponseAction string            `json:"response_action"`
+		Errors         map[string]string `json:"errors"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.ResponseAction != "errors" || len(response.Errors) != 1 || !strings.Contains(response.Errors["param_1"], "semantic version") {
+		t.Errorf("expected error for version only but got %s", recorder.Body.String())
+	}
+}
+
+func TestButtonRunsCommand(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{deployAction}})
+	defer cleanup()
+	opened := make(chan string, 1)
+	bot.OpenForm = func(trigger string, a *Action, channel string) error {
+		opened <- trigger + " " + a.Name + " " + channel
+		return nil
+	}
+	handler := &InteractionHandler{SigningSecret: "secret", Bot: bot}
+
+	payload := `{"type":"interactive_message","callback_id":"chatops_command","trigger_id":"T1","user":{"id":"U1"},"channel":{"id":"C1"},"actions":[{"name":"command","value":"run deploy"}]}`
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, interactionRequest(payload))
+	select {
+	case form := <-opened:
+		if form != "T1 deploy C1" {
+			t.Errorf("unexpected form %s", form)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("form was not opened")
+	}
+}
+
+func TestRunWithoutFormsOffersButton(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{deployAction}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "run deploy"}, response)
+	if text := response.text(); !strings.Contains(text, "`deploy <env> <version>`") || !strings.Contains(text, "[Enter parameters: run deploy]") {
+		t.Errorf("expected usage with a button but got %s", text)
+	}
+}
+
+func TestRunActionUsesValues(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{Actions: []Action{deployAction}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.RunAction(context.Background(), Message{User: "U1", Channel: "C1"}, "deploy", []string{"", "1.2.3"}, response)
+	if text := response.text(); !strings.Contains(text, "dev 1.2.3") {
+		t.Errorf("expected default env and version in output but got %s", text)
+	}
+}
+
+func TestOpenView(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/views.open" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	if err := OpenView(server.URL+"/api/", "xoxb-test", "T1", ParamsView(&deployAction, "C1")); err != nil {
+		t.Fatal(err)
+	}
+	if received["trigger_id"] != "T1" || received["view"] == nil {
+		t.Errorf("unexpected request %v", received)
+	}
+}
@@ -0,0 +1,172 @@
+package slackchatops
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultInlineLines is the longest output posted inline when neither the action nor the configuration set InlineLines
+	DefaultInlineLines = 40
+	// DefaultPreviewLines is how many lines of the start and end of long output are shown when PreviewLines isn't set
+	DefaultPreviewLines = 10
+	// maxInlineChars keeps inline output well below Slack's message size limit
+	maxInlineChars = 3500
+	// maxPreviewLineChars cuts very long lines in a preview
+	maxPreviewLineChars = 200
+	// formattedExtraLines leaves room for the exit code and table headers of formatted output
+	formattedExtraLines = 4
+)
+
+// ansiEscape matches terminal color and cursor sequences (CSI) and title sequences (OSC)
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(\x07|\x1b\\\\)|\x1b[@-Z\\\\-_]")
+
+// stripANSI removes escape codes and keeps only what is visible after carriage returns so
+// progress bars don't show every step
+func stripANSI(text string) string {
+	text = ansiEscape.ReplaceAllString(text, "")
+	if !strings.Contains(text, "\r") {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if j := strings.LastIndex(line, "\r"); j >= 0 {
+			line = line[j+1:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeSlack escapes the characters Slack uses for links and mentions so command output
+// can't ping channels or render as markup
+func escapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// cleanOutput prepares command output to be posted
+func cleanOutput(text string) string {
+	return escapeSlack(stripANSI(text))
+}
+
+// inlineLines returns the longest output of the action posted inline
+func (c *Config) inlineLines(a *Action) int {
+	switch {
+	case a != nil && a.InlineLines > 0:
+		return a.InlineLines
+	case c.InlineLines > 0:
+		return c.InlineLines
+	}
+	return DefaultInlineLines
+}
+
+// previewLines returns how many lines of the start and end of long output are shown
+func (c *Config) previewLines(a *Action) int {
+	switch {
+	case a != nil && a.PreviewLines > 0:
+		return a.PreviewLines
+	case c.PreviewLines > 0:
+		return c.PreviewLines
+	}
+	return DefaultPreviewLines
+}
+
+// lineCount returns the number of lines of the text, ignoring a trailing newline
+func lineCount(text string) int {
+	if text == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimRight(text, "\n"), "\n") + 1
+}
+
+// isLong returns true when the text has more lines than limit or doesn't fit in a message
+func isLong(text string, limit int) bool {
+	return len(text) > maxInlineChars || lineCount(text) > limit
+}
+
+// preview keeps the first and last n lines of text, cutting very long lines
+func preview(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > 2*n {
+		skipped := len(lines) - 2*n
+		lines = append(append(lines[:n:n], fmt.Sprintf("... %d more lines ...", skipped)), lines[len(lines)-n:]...)
+	}
+	for i, line := range lines {
+		if runes := []rune(line); len(runes) > maxPreviewLineChars {
+			lines[i] = string(runes[:maxPreviewLineChars]) + "..."
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replyOutput posts the output (and errors when showErrors is set) of a run in code blocks. Output
+// that is too long is shown as a preview of its start and end and uploaded as a file. The full
+// output also stays available with `show <id>`
+func (b *Bot) replyOutput(a *Action, run Run, showErrors bool, response Responder) {
+	config := b.Config()
+	stdout, stderr := stripANSI(run.StdOut), stripANSI(run.StdError)
+	if !showErrors || strings.TrimSpace(stderr) == "" {
+		stderr = ""
+	}
+	if strings.TrimSpace(stdout) == "" {
+		stdout = ""
+	}
+
+	limit := config.inlineLines(a)
+	if !isLong(stdout, limit) && !isLong(stderr, limit) {
+		if stdout != "" {
+			response.Reply("_Output:_\n" + codeBlock(escapeSlack(stdout)))
+		}
+		if stderr != "" {
+			response.Reply("_Error:_\n" + codeBlock(escapeSlack(stderr)))
+		}
+		return
+	}
+
+	n := config.previewLines(a)
+	text := ""
+	if stdout != "" {
+		text += fmt.Sprintf("_Output (%d lines, start and end):_\n%s\n", lineCount(stdout), codeBlock(escapeSlack(preview(stdout, n))))
+	}
+	if stderr != "" {
+		text += fmt.Sprintf("_Error (%d lines, start and end):_\n%s\n", lineCount(stderr), codeBlock(escapeSlack(preview(stderr, n))))
+	}
+	if run.ID != "" {
+		text += fmt.Sprintf("_Full output: `show %s`_", run.ID)
+	}
+	response.Reply(strings.TrimSpace(text))
+
+	// the file is uploaded as it was printed, only without escape codes
+	content := stdout
+	if stderr != "" {
+		content += "\n--- stderr ---\n" + stderr
+	}
+	if err := uploadText(response, run, content); err != nil {
+		b.Log.WithFields(logrus.Fields{"command": run.Action, "job": run.ID}).Warn("Unable to upload output: ", err)
+	}
+}
+
+// uploadText writes the content to a temporary file named after the run and uploads it
+func uploadText(response Responder, run Run, content string) error {
+	dir, err := ioutil.TempDir("", "chatops")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	name := run.Action
+	if run.ID != "" {
+		name += "-" + run.ID
+	}
+	path := filepath.Join(dir, name+".txt")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return err
+	}
+	return response.Upload(path, strings.TrimSpace("Output of "+run.Action+" "+run.ID))
+}
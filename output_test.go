@@ -0,0 +1,71 @@
+package slackchatops
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCleanOutput(t *testing.T) {
+	tests := map[string]string{
+		"\x1b[31mred\x1b[0m and \x1b[1;32mgreen\x1b[0m": "red and green",
+		"\x1b]0;title\x07text":                          "text",
+		"10%\r50%\r100%\ndone\r\n":                      "100%\ndone\n",
+		"<!channel> a & b <@U1>":                        "&lt;!channel&gt; a &amp; b &lt;@U1&gt;",
+	}
+	for input, expected := range tests {
+		if output := cleanOutput(input); output != expected {
+			t.Errorf("expected %q but got %q", expected, output)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	lines := []string{}
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+	if p := preview(strings.Join(lines, "\n")+"\n", 2); p != "x\nxx\n... 6 more lines ...\nxxxxxxxxx\nxxxxxxxxxx" {
+		t.Errorf("unexpected preview %q", p)
+	}
+	if p := preview("short\n", 2); p != "short" {
+		t.Errorf("expected short text to be kept but got %q", p)
+	}
+	if p := preview(strings.Repeat("é", 300), 2); p != strings.Repeat("é", maxPreviewLineChars)+"..." {
+		t.Errorf("expected long line to be cut but got %q", p)
+	}
+}
+
+func TestBotUploadsLongOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs seq")
+	}
+	bot, cleanup := newTestBot(t, &Config{InlineLines: 5, PreviewLines: 2, Actions: []Action{
+		{Name: "count", Command: "seq", Args: []string{"{0}"}, Params: []Param{{Name: "n"}}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "count 3"}, response)
+	if text := response.text(); !strings.Contains(text, "_Output:_\n```1\n2\n3\n```") || len(response.uploads) != 0 {
+		t.Errorf("expected short output inline but got %s", text)
+	}
+
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "count 100"}, response)
+	text := response.text()
+	if !strings.Contains(text, "_Output (100 lines, start and end):_\n```1\n2\n... 96 more lines ...\n99\n100```") || !strings.Contains(text, "_Full output: `show ") {
+		t.Errorf("expected preview of long output but got %s", text)
+	}
+	if len(response.uploads) != 1 || !strings.HasPrefix(response.uploads[0], "Output of count ") || !strings.HasSuffix(response.uploads[0], "\n99\n100\n") {
+		t.Errorf("expected full output to be uploaded but got %v", response.uploads)
+	}
+
+	id := bot.History.Recent("count", 1)[0].ID
+	response = &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "show " + id}, response)
+	if len(response.uploads) != 1 {
+		t.Errorf("expected show to upload the full output again but got %s", response.text())
+	}
+}
@@ -0,0 +1,182 @@
+package slackchatops
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameter types
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamBool     = "bool"
+	ParamEnum     = "enum"
+	ParamRegex    = "regex"
+	ParamSemver   = "semver"
+	ParamDuration = "duration"
+)
+
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// Param describes a value the user passes in when running an action. In config.yaml a param
+// can either be a plain name (a required string) or an object with any of the below fields
+type Param struct {
+	Name    string   // name shown in help and used as the token in the command
+	Type    string   // string (default), int, bool, enum, regex, semver or duration
+	Pattern string   // regular expression the whole value must match. Required for the regex type
+	Choices []string // allowed values for the enum type
+	Min     string   // smallest allowed value for int and duration types
+	Max     string   // largest allowed value for int and duration types
+	Default string   // value used when the user leaves the param out. Params without a default are required
+}
+
+// UnmarshalYAML allows a param to be written as just its name
+func (p *Param) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*p = Param{Name: name}
+		return nil
+	}
+	type plain Param
+	return unmarshal((*plain)(p))
+}
+
+// MarshalYAML writes params that only have a name in the short form
+func (p Param) MarshalYAML() (interface{}, error) {
+	if p.Type == "" && p.Pattern == "" && len(p.Choices) == 0 && p.Min == "" && p.Max == "" && p.Default == "" {
+		return p.Name, nil
+	}
+	type plain Param
+	return plain(p), nil
+}
+
+// Validate checks the param definition itself
+func (p Param) Validate() error {
+	switch p.Type {
+	case "", ParamString, ParamBool, ParamSemver:
+	case ParamInt, ParamDuration:
+		for _, limit := range []string{p.Min, p.Max} {
+			if limit == "" {
+				continue
+			}
+			if _, err := p.number(limit); err != nil {
+				return fmt.Errorf("Param %s has invalid min/max %s for type %s", p.Name, limit, p.Type)
+			}
+		}
+	case ParamEnum:
+		if len(p.Choices) == 0 {
+			return fmt.Errorf("Param %s is an enum without any choices", p.Name)
+		}
+	case ParamRegex:
+		if p.Pattern == "" {
+			return fmt.Errorf("Param %s is a regex without a pattern", p.Name)
+		}
+	default:
+		return fmt.Errorf("Param %s has unknown type %s", p.Name, p.Type)
+	}
+	if p.Pattern != "" {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("Param %s has invalid pattern: %v", p.Name, err)
+		}
+	}
+	if p.Default != "" {
+		if err := p.Check(p.Default); err != nil {
+			return fmt.Errorf("Param %s has invalid default: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Check validates a value passed in by the user. The error describes what is allowed
+func (p Param) Check(value string) error {
+	if value == "" {
+		return fmt.Errorf("`%s` is required", p.Name)
+	}
+	if p.Pattern != "" {
+		if re, err := regexp.Compile("^(?:" + p.Pattern + ")$"); err == nil && !re.MatchString(value) {
+			return fmt.Errorf("`%s` must match `%s`", p.Name, p.Pattern)
+		}
+	}
+
+	switch p.Type {
+	case ParamInt, ParamDuration:
+		n, err := p.number(value)
+		if err != nil {
+			if p.Type == ParamInt {
+				return fmt.Errorf("`%s` must be a whole number", p.Name)
+			}
+			return fmt.Errorf("`%s` must be a duration (ex: 90s, 5m, 1h)", p.Name)
+		}
+		if p.Min != "" {
+			if min, _ := p.number(p.Min); n < min {
+				return fmt.Errorf("`%s` must be at least %s", p.Name, p.Min)
+			}
+		}
+		if p.Max != "" {
+			if max, _ := p.number(p.Max); n > max {
+				return fmt.Errorf("`%s` must be at most %s", p.Name, p.Max)
+			}
+		}
+	case ParamBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("`%s` must be true or false", p.Name)
+		}
+	case ParamEnum:
+		for _, c := range p.Choices {
+			if value == c {
+				return nil
+			}
+		}
+		return fmt.Errorf("`%s` must be one of %s", p.Name, strings.Join(p.Choices, ", "))
+	case ParamSemver:
+		if !semverPattern.MatchString(value) {
+			return fmt.Errorf("`%s` must be a semantic version (ex: 1.4.2)", p.Name)
+		}
+	}
+	return nil
+}
+
+// number parses an int or duration value so both can be compared against min/max
+func (p Param) number(value string) (int64, error) {
+	if p.Type == ParamDuration {
+		d, err := time.ParseDuration(value)
+		return int64(d), err
+	}
+	n, err := strconv.Atoi(value)
+	return int64(n), err
+}
+
+// ValidateParams applies defaults to the values passed in by the user (in the same order as
+// Params) and checks each one. All problems are reported together, one per line
+func (a *Action) ValidateParams(values []string) ([]string, error) {
+	result := make([]string, len(a.Params))
+	problems := []string{}
+	for i, p := range a.Params {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		if value == "" {
+			value = p.Default
+		}
+		result[i] = value
+		if err := p.Check(value); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return result, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return result, nil
+}
+
+func (a *Action) paramNames() []string {
+	names := make([]string, len(a.Params))
+	for i, p := range a.Params {
+		names[i] = p.Name
+	}
+	return names
+}
@@ -0,0 +1,78 @@
+package slackchatops
+
+import (
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestParamsYamlFormats(t *testing.T) {
+	data := `
+name: deploy
+params:
+- service
+- name: env
+  type: enum
+  choices: [dev, prod]
+  default: dev
+`
+	var action Action
+	if err := yaml.Unmarshal([]byte(data), &action); err != nil {
+		t.Fatal(err)
+	}
+	if len(action.Params) != 2 || action.Params[0].Name != "service" || action.Params[1].Type != ParamEnum {
+		t.Errorf("Unexpected params %+v", action.Params)
+	}
+
+	out, _ := yaml.Marshal(action.Params)
+	if !strings.HasPrefix(string(out), "- service\n") {
+		t.Errorf("Plain param was not written in short form:\n%s", out)
+	}
+}
+
+func TestParamCheck(t *testing.T) {
+	tests := []struct {
+		param Param
+		value string
+		valid bool
+	}{
+		{Param{Name: "a"}, "anything", true},
+		{Param{Name: "a"}, "", false},
+		{Param{Name: "a", Type: ParamInt, Min: "1", Max: "10"}, "5", true},
+		{Param{Name: "a", Type: ParamInt, Min: "1", Max: "10"}, "11", false},
+		{Param{Name: "a", Type: ParamInt}, "five", false},
+		{Param{Name: "a", Type: ParamBool}, "true", true},
+		{Param{Name: "a", Type: ParamBool}, "yes", false},
+		{Param{Name: "a", Type: ParamEnum, Choices: []string{"dev", "prod"}}, "prod", true},
+		{Param{Name: "a", Type: ParamEnum, Choices: []string{"dev", "prod"}}, "qa", false},
+		{Param{Name: "a", Type: ParamRegex, Pattern: "[a-z]+"}, "abc", true},
+		{Param{Name: "a", Type: ParamRegex, Pattern: "[a-z]+"}, "abc1", false},
+		{Param{Name: "a", Type: ParamSemver}, "1.4.2-rc.1", true},
+		{Param{Name: "a", Type: ParamSemver}, "1.4", false},
+		{Param{Name: "a", Type: ParamDuration, Max: "1h"}, "30m", true},
+		{Param{Name: "a", Type: ParamDuration, Max: "1h"}, "2h", false},
+	}
+	for _, test := range tests {
+		err := test.param.Check(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("%+v with %q: expected valid=%v but got %v", test.param, test.value, test.valid, err)
+		}
+	}
+}
+
+func TestValidateParamsAppliesDefaults(t *testing.T) {
+	action := Action{Name: "Foo", Params: []Param{{Name: "id", Type: ParamInt}, {Name: "env", Default: "dev"}}}
+	values, err := action.ValidateParams([]string{"12"})
+	if err != nil {
+		t.Error(err)
+	}
+	if values[1] != "dev" {
+		t.Error("Default was not applied")
+	}
+
+	_, err = action.ValidateParams([]string{"abc", ""})
+	if err == nil || !strings.Contains(err.Error(), "`id`") {
+		t.Error("Expected error naming the invalid parameter")
+	}
+}
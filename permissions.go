@@ -0,0 +1,184 @@
+package slackchatops
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Everyone matches every user in an allow or deny rule
+const Everyone = "*"
+
+// userGroupID matches Slack user group ids such as S0123ABCD
+var userGroupID = regexp.MustCompile(`^S[A-Z0-9]{8,}$`)
+
+// Rule grants or denies access to an action. In config.yaml a rule can be written as just the
+// role name, slackId or * or as an object limiting it to certain channels
+type Rule struct {
+	Who      string   // role name, slackId, Slack user group handle (@oncall) or * for everyone
+	Channels []string // channels the rule applies to. Empty means every channel
+}
+
+// UnmarshalYAML allows a rule to be written as just who it applies to
+func (r *Rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var who string
+	if err := unmarshal(&who); err == nil {
+		*r = Rule{Who: who}
+		return nil
+	}
+	type plain Rule
+	return unmarshal((*plain)(r))
+}
+
+// MarshalYAML writes rules without channels in the short form
+func (r Rule) MarshalYAML() (interface{}, error) {
+	if len(r.Channels) == 0 {
+		return r.Who, nil
+	}
+	type plain Rule
+	return plain(r), nil
+}
+
+func (r Rule) String() string {
+	if len(r.Channels) == 0 {
+		return r.Who
+	}
+	return r.Who + " in " + strings.Join(r.Channels, ", ")
+}
+
+// Decision explains whether a user may run an action
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// Permissions decides who may run which action based on roles
+type Permissions struct {
+	Roles        map[string][]string                   // role name to members. Members are slackIds or Slack user group handles (@oncall)
+	GroupMembers func(handle string) ([]string, error) // resolves a Slack user group handle (without the @) to its members. Optional
+}
+
+// NewPermissions creates permissions for the given roles
+func NewPermissions(roles map[string][]string) *Permissions {
+	if roles == nil {
+		roles = map[string][]string{}
+	}
+	return &Permissions{Roles: roles}
+}
+
+// Check decides whether the user may run the action in the channel. Deny rules win over allow
+// rules. Actions without any allow rules or AuthorizedUsers can be run by everyone
+func (p *Permissions) Check(a *Action, user string, channel string) Decision {
+	for _, rule := range a.Deny {
+		if p.matches(rule, user, channel) {
+			return Decision{Allowed: false, Reason: "denied by rule " + rule.String()}
+		}
+	}
+	if len(a.Allow) == 0 && len(a.AuthorizedUsers) == 0 {
+		return Decision{Allowed: true, Reason: "action has no restrictions"}
+	}
+	for _, u := range a.AuthorizedUsers {
+		if u == user {
+			return Decision{Allowed: true, Reason: "listed in authorizedusers"}
+		}
+	}
+	for _, rule := range a.Allow {
+		if p.matches(rule, user, channel) {
+			return Decision{Allowed: true, Reason: "allowed by rule " + rule.String()}
+		}
+	}
+	return Decision{Allowed: false, Reason: "no allow rule matches you in this channel"}
+}
+
+// RolesOf returns the names of the roles the user belongs to
+func (p *Permissions) RolesOf(user string) []string {
+	roles := []string{}
+	for name := range p.Roles {
+		if p.inRole(name, user) {
+			roles = append(roles, name)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Members returns the slackIds of a role, or of a Slack user group when name is a handle (@oncall)
+func (p *Permissions) Members(name string) ([]string, error) {
+	if strings.HasPrefix(name, "@") {
+		if p.GroupMembers == nil {
+			return nil, fmt.Errorf("Slack user group %s can't be resolved", name)
+		}
+		return p.GroupMembers(strings.TrimPrefix(name, "@"))
+	}
+	members, ok := p.Roles[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown role %s", name)
+	}
+	result := []string{}
+	for _, m := range members {
+		if strings.HasPrefix(m, "@") {
+			// an unresolvable user group shouldn't lock out the rest of the role
+			resolved, _ := p.Members(m)
+			result = append(result, resolved...)
+		} else {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// Validate ensures every rule of the action refers to something that exists
+func (p *Permissions) Validate(a *Action) error {
+	for _, rule := range append(append([]Rule{}, a.Allow...), a.Deny...) {
+		if rule.Who == "" {
+			return fmt.Errorf("Action %s has a rule without who it applies to", a.Name)
+		}
+		if rule.Who == Everyone || strings.HasPrefix(rule.Who, "@") || isSlackID(rule.Who) {
+			continue
+		}
+		if _, ok := p.Roles[rule.Who]; !ok {
+			return fmt.Errorf("Action %s references unknown role %s", a.Name, rule.Who)
+		}
+	}
+	return nil
+}
+
+func (p *Permissions) matches(rule Rule, user string, channel string) bool {
+	if len(rule.Channels) > 0 && !contains(rule.Channels, channel) {
+		return false
+	}
+	switch {
+	case rule.Who == Everyone || rule.Who == user:
+		return true
+	case strings.HasPrefix(rule.Who, "@"):
+		members, err := p.Members(rule.Who)
+		return err == nil && contains(members, user)
+	default:
+		return p.inRole(rule.Who, user)
+	}
+}
+
+func (p *Permissions) inRole(role string, user string) bool {
+	members, err := p.Members(role)
+	return err == nil && contains(members, user)
+}
+
+// IsUserGroupID returns true for Slack user group ids such as S0123ABCD. Role names (ex: SRE) aren't ids
+func IsUserGroupID(id string) bool {
+	return userGroupID.MatchString(id)
+}
+
+// isSlackID returns true for user ids such as U0123ABCD or W0123ABCD
+func isSlackID(id string) bool {
+	return len(id) > 1 && (id[0] == 'U' || id[0] == 'W') && strings.ToUpper(id) == id
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package slackchatops
+
+import "testing"
+
+func TestPermissionsCheck(t *testing.T) {
+	permissions := NewPermissions(map[string][]string{
+		"ops":  {"U1", "@oncall"},
+		"devs": {"U3"},
+	})
+	permissions.GroupMembers = func(handle string) ([]string, error) {
+		return []string{"U2"}, nil
+	}
+	action := Action{
+		Name:  "deploy",
+		Allow: []Rule{{Who: "ops"}, {Who: "devs", Channels: []string{"CDEV"}}},
+		Deny:  []Rule{{Who: "U4"}},
+	}
+
+	tests := []struct {
+		user    string
+		channel string
+		allowed bool
+	}{
+		{"U1", "CPROD", true},
+		{"U2", "CPROD", true}, // member of @oncall
+		{"U3", "CDEV", true},
+		{"U3", "CPROD", false},
+		{"U4", "CDEV", false},
+		{"U5", "CDEV", false},
+	}
+	for _, test := range tests {
+		if d := permissions.Check(&action, test.user, test.channel); d.Allowed != test.allowed {
+			t.Errorf("%s in %s: expected allowed=%v but got %+v", test.user, test.channel, test.allowed, d)
+		}
+	}
+}
+
+func TestPermissionsDenyWins(t *testing.T) {
+	permissions := NewPermissions(map[string][]string{"ops": {"U1"}})
+	action := Action{Name: "drop", AuthorizedUsers: []string{"U1"}, Deny: []Rule{{Who: "ops", Channels: []string{"CPROD"}}}}
+	if permissions.Check(&action, "U1", "CPROD").Allowed {
+		t.Error("Deny rule should win over authorized users")
+	}
+	if !permissions.Check(&action, "U1", "CDEV").Allowed {
+		t.Error("Deny rule should only apply in its channels")
+	}
+}
+
+func TestPermissionsValidate(t *testing.T) {
+	permissions := NewPermissions(map[string][]string{"ops": {"U1"}})
+	if err := permissions.Validate(&Action{Name: "a", Allow: []Rule{{Who: "ops"}, {Who: "U0ABC"}, {Who: "*"}}}); err != nil {
+		t.Error(err)
+	}
+	if err := permissions.Validate(&Action{Name: "a", Allow: []Rule{{Who: "opps"}}}); err == nil {
+		t.Error("Expected unknown role to be reported")
+	}
+}
+
+func TestRolesOf(t *testing.T) {
+	permissions := NewPermissions(map[string][]string{"ops": {"U1"}, "devs": {"U1", "U2"}})
+	roles := permissions.RolesOf("U1")
+	if len(roles) != 2 || roles[0] != "devs" {
+		t.Errorf("Unexpected roles %v", roles)
+	}
+}
+
+func TestRoleNamesAreNotUserGroups(t *testing.T) {
+	if !IsUserGroupID("S0123ABCD") || IsUserGroupID("SRE") || IsUserGroupID("Support") {
+		t.Error("expected only ids like S0123ABCD to be user groups")
+	}
+	if text := mentions([]string{"SRE", "Support", "S0123ABCD", "U1"}); text != "`SRE`, `Support`, <!subteam^S0123ABCD>, <@U1>" {
+		t.Errorf("unexpected mentions %s", text)
+	}
+}
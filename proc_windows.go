@@ -0,0 +1,26 @@
+package slackchatops
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup is a no-op on windows. taskkill /T is used to reach child processes instead
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// terminateProcessGroup asks the command and its entire process tree to exit
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
+
+// killProcessGroup kills the command and its entire process tree
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
@@ -0,0 +1,290 @@
+package slackchatops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// DefaultScheduleFile is used when the configuration doesn't set a ScheduleFile
+const DefaultScheduleFile = "schedules.json"
+
+// Catch up policies for runs missed while the bot wasn't running
+const (
+	CatchUpSkip = "skip" // missed runs are dropped (default)
+	CatchUpOnce = "once" // a single run makes up for any number of missed ones
+	CatchUpAll  = "all"  // every missed run is made up, oldest first
+)
+
+const (
+	// scheduleGrace is how late a run may start before it counts as missed
+	scheduleGrace = 2 * time.Minute
+	// maxCatchUp limits how many missed runs the all policy makes up
+	maxCatchUp = 100
+)
+
+// Schedule runs an action or workflow with fixed args on a cron expression
+type Schedule struct {
+	Name     string
+	Action   string   // action or workflow to run
+	Args     []string // values of the action's params
+	Cron     string   // minute hour day-of-month month day-of-week, or @hourly, @daily, @weekly, @monthly, @yearly
+	TimeZone string   // IANA time zone the cron expression is evaluated in (ex: Europe/Paris). Defaults to the local time zone
+	Channel  string   // channel results are posted to. Defaults to SlackChannel
+	CatchUp  string   // what to do with runs missed while the bot was down: skip (default), once or all
+
+	cron     *Cron
+	location *time.Location
+}
+
+// Validate parses the cron expression and time zone and checks the action and args against the configuration
+func (s *Schedule) Validate(config *Config, find func(name string) *Action) error {
+	if s.Name == "" {
+		return fmt.Errorf("Schedule for %s has no name", s.Action)
+	}
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		return fmt.Errorf("Schedule %s: %v", s.Name, err)
+	}
+	location, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return fmt.Errorf("Schedule %s has unknown time zone %s", s.Name, s.TimeZone)
+	}
+	switch s.CatchUp {
+	case "", CatchUpSkip, CatchUpOnce, CatchUpAll:
+	default:
+		return fmt.Errorf("Schedule %s has unknown catchup %s. Use skip, once or all", s.Name, s.CatchUp)
+	}
+	if s.channel(config) == "" {
+		return fmt.Errorf("Schedule %s needs a channel to post to", s.Name)
+	}
+	a := find(s.Action)
+	if a == nil {
+		return fmt.Errorf("Schedule %s runs unknown action %s", s.Name, s.Action)
+	}
+	if a.Confirm.Enabled || a.RequiresApproval {
+		return fmt.Errorf("Schedule %s can't run %s because it needs confirmation or approval", s.Name, s.Action)
+	}
+	if _, err := a.ValidateParams(s.Args); err != nil {
+		return fmt.Errorf("Schedule %s: %v", s.Name, err)
+	}
+	s.cron, s.location = cron, location
+	return nil
+}
+
+// Next returns the next time the schedule runs after t
+func (s *Schedule) Next(t time.Time) time.Time {
+	return s.cron.Next(t.In(s.location))
+}
+
+// channel returns where the schedule's results are posted
+func (s *Schedule) channel(config *Config) string {
+	if s.Channel != "" {
+		return s.Channel
+	}
+	return config.SlackChannel
+}
+
+// scheduleState is what is remembered about a schedule across restarts
+type scheduleState struct {
+	Last     time.Time // latest time the schedule was due
+	Paused   bool
+	PausedBy string
+}
+
+// Schedules keeps track of when each schedule last ran and whether it is paused. The state
+// is saved to a JSON file so missed runs can be caught up after a restart
+type Schedules struct {
+	mu    sync.Mutex
+	path  string
+	state map[string]*scheduleState
+}
+
+// OpenSchedules loads the state stored at path. The file is created once a schedule runs if it doesn't exist
+func OpenSchedules(path string) (*Schedules, error) {
+	s := &Schedules{path: path, state: map[string]*scheduleState{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Pause stops a schedule from running until it is resumed
+func (s *Schedules) Pause(name string, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.get(name)
+	if state.Paused {
+		return fmt.Errorf("Schedule %s is already paused", name)
+	}
+	state.Paused, state.PausedBy = true, user
+	return s.save()
+}
+
+// Resume lets a paused schedule run again. Runs missed while it was paused are not caught up
+func (s *Schedules) Resume(name string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.get(name)
+	if !state.Paused {
+		return fmt.Errorf("Schedule %s is not paused", name)
+	}
+	state.Paused, state.PausedBy, state.Last = false, "", now
+	return s.save()
+}
+
+// Status returns when the schedule was last due and who paused it, if it is paused
+func (s *Schedules) Status(name string) (last time.Time, paused bool, pausedBy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.get(name)
+	return state.Last, state.Paused, state.PausedBy
+}
+
+// Due returns the times the schedule should run for at now according to its catch up policy.
+// A schedule seen for the first time only starts counting from now
+func (s *Schedules) Due(schedule *Schedule, now time.Time) []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.get(schedule.Name)
+	last := state.Last
+	state.Last = now
+	if last.IsZero() {
+		s.save()
+		return nil
+	}
+
+	times := []time.Time{}
+	for t := schedule.Next(last); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		times = append(times, t)
+		if len(times) > maxCatchUp {
+			times = times[1:]
+		}
+	}
+	if len(times) == 0 {
+		return nil
+	}
+	// only remember the time when the schedule was due so idle ticks don't write the file
+	s.save()
+	if state.Paused {
+		return nil
+	}
+
+	latest := times[len(times)-1]
+	switch schedule.CatchUp {
+	case CatchUpAll:
+		return times
+	case CatchUpOnce:
+		return times[len(times)-1:]
+	default:
+		if now.Sub(latest) > scheduleGrace {
+			return nil
+		}
+		return times[len(times)-1:]
+	}
+}
+
+func (s *Schedules) get(name string) *scheduleState {
+	state, ok := s.state[name]
+	if !ok {
+		state = &scheduleState{}
+		s.state[name] = state
+	}
+	return state
+}
+
+// save writes the state to a temp file renamed over the original
+func (s *Schedules) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// RunSchedules runs the schedules of the active configuration until the context is done.
+// Results are posted through Responder
+func (b *Bot) RunSchedules(ctx context.Context) {
+	for {
+		b.tickSchedules(ctx, time.Now())
+		// wake up just after the start of the next minute
+		now := time.Now()
+		wait := now.Truncate(time.Minute).Add(time.Minute + time.Second).Sub(now)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tickSchedules starts every schedule that is due at now. Each schedule runs in its own goroutine
+// so long jobs don't delay the others. The returned WaitGroup is done once all of them finished
+func (b *Bot) tickSchedules(ctx context.Context, now time.Time) *sync.WaitGroup {
+	b.mu.RLock()
+	s := b.setup
+	b.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for i := range s.config.Schedules {
+		schedule := &s.config.Schedules[i]
+		times := b.Schedules.Due(schedule, now)
+		if len(times) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, at := range times {
+				if ctx.Err() != nil {
+					return
+				}
+				b.runSchedule(ctx, s, schedule, at)
+			}
+		}()
+	}
+	return &wg
+}
+
+// runSchedule runs the schedule's action as if it had been typed in its channel. Permissions,
+// confirmation and approvals are skipped since the schedule is part of the configuration
+func (b *Bot) runSchedule(ctx context.Context, s *setup, schedule *Schedule, at time.Time) {
+	r, ok := s.runnables[schedule.Action]
+	if !ok {
+		return
+	}
+	channel := schedule.channel(s.config)
+	if b.Responder == nil {
+		b.Log.WithFields(logrus.Fields{"schedule": schedule.Name}).Warn("No responder to post scheduled run to")
+		return
+	}
+	response := b.Responder(channel)
+	b.Log.WithFields(logrus.Fields{"schedule": schedule.Name, "command": r.action.Name, "due": at}).Info("ScheduledRun")
+
+	values, err := r.action.ValidateParams(schedule.Args)
+	if err != nil {
+		response.Alert(AlertDanger, "Invalid parameters for "+r.action.Name, err.Error())
+		return
+	}
+	response.Reply(fmt.Sprintf("Running schedule `%s` due at %s: `%s`", schedule.Name, at.In(schedule.location).Format(timeFormat+" MST"), strings.TrimSpace(r.action.Name+" "+strings.Join(values, " "))))
+	request := &Request{Message: Message{User: "schedule:" + schedule.Name, Channel: channel}, ctx: ctx, system: true}
+	b.runJob(r, request, values, response, nil)
+}
@@ -0,0 +1,132 @@
+package slackchatops
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSchedule(t *testing.T, catchUp string) *Schedule {
+	s := &Schedule{Name: "backup", Action: "backup", Cron: "0 * * * *", TimeZone: "UTC", Channel: "C1", CatchUp: catchUp}
+	err := s.Validate(&Config{}, func(name string) *Action { return &Action{Name: name} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSchedulesCatchUp(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "schedules")
+	defer os.RemoveAll(dir)
+	start := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	down := start.Add(3*time.Hour + 10*time.Minute) // missed 11:00, 12:00 and 13:00
+
+	tests := []struct {
+		catchUp  string
+		expected int
+	}{
+		{"", 0},
+		{CatchUpOnce, 1},
+		{CatchUpAll, 3},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.catchUp+"schedules.json")
+		schedules, _ := OpenSchedules(path)
+		schedule := testSchedule(t, test.catchUp)
+		if due := schedules.Due(schedule, start); len(due) != 0 {
+			t.Errorf("expected nothing due the first time a schedule is seen but got %v", due)
+		}
+
+		// the state survives a restart
+		schedules, err := OpenSchedules(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if due := schedules.Due(schedule, down); len(due) != test.expected {
+			t.Errorf("%q: expected %d missed runs but got %v", test.catchUp, test.expected, due)
+		}
+		if due := schedules.Due(schedule, down.Add(20*time.Minute+10*time.Second)); len(due) != 1 || due[0].Hour() != 14 {
+			t.Errorf("%q: expected the 14:00 run but got %v", test.catchUp, due)
+		}
+	}
+}
+
+func TestSchedulesPause(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "schedules")
+	defer os.RemoveAll(dir)
+	schedules, _ := OpenSchedules(filepath.Join(dir, "schedules.json"))
+	schedule := testSchedule(t, CatchUpAll)
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	schedules.Due(schedule, now)
+
+	schedules.Pause("backup", "U1")
+	if err := schedules.Pause("backup", "U1"); err == nil {
+		t.Errorf("expected pausing twice to fail")
+	}
+	if due := schedules.Due(schedule, now.Add(time.Hour)); len(due) != 0 {
+		t.Errorf("expected paused schedule not to run but got %v", due)
+	}
+	schedules.Resume("backup", now.Add(2*time.Hour))
+	if due := schedules.Due(schedule, now.Add(2*time.Hour+time.Minute)); len(due) != 0 {
+		t.Errorf("expected runs missed while paused not to be caught up but got %v", due)
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	config := &Config{Actions: []Action{
+		{Name: "greet", Params: []Param{{Name: "name"}}, Args: []string{"{0}"}},
+		{Name: "drop", Confirm: Confirm{Enabled: true}},
+		{Name: "release", RequiresApproval: true, Approvers: []string{"U2"}},
+	}}
+	find := func(name string) *Action { return config.FindAction(name) }
+	tests := []Schedule{
+		{Name: "cron", Action: "greet", Args: []string{"bob"}, Cron: "* *", Channel: "C1"},
+		{Name: "zone", Action: "greet", Args: []string{"bob"}, Cron: "@daily", TimeZone: "Mars/Olympus", Channel: "C1"},
+		{Name: "action", Action: "nope", Cron: "@daily", Channel: "C1"},
+		{Name: "args", Action: "greet", Cron: "@daily", Channel: "C1"},
+		{Name: "channel", Action: "greet", Args: []string{"bob"}, Cron: "@daily"},
+		{Name: "catchup", Action: "greet", Args: []string{"bob"}, Cron: "@daily", Channel: "C1", CatchUp: "sometimes"},
+		{Name: "confirm", Action: "drop", Cron: "@daily", Channel: "C1"},
+		{Name: "approval", Action: "release", Cron: "@daily", Channel: "C1"},
+	}
+	for _, s := range tests {
+		if err := s.Validate(config, find); err == nil {
+			t.Errorf("expected schedule %s to be invalid", s.Name)
+		}
+	}
+}
+
+func TestBotRunsSchedules(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bot, cleanup := newTestBot(t, &Config{
+		Actions:   []Action{{Name: "greet", Command: "sh", Args: []string{"-c", "echo hello {0}"}, Params: []Param{{Name: "name"}}}},
+		Schedules: []Schedule{{Name: "morning", Action: "greet", Args: []string{"team"}, Cron: "0 9 * * *", TimeZone: "UTC", Channel: "C1"}},
+	})
+	defer cleanup()
+	response := &fakeResponder{}
+	bot.Responder = func(channel string) Responder { return response }
+
+	day := time.Date(2024, 1, 1, 8, 59, 0, 0, time.UTC)
+	bot.tickSchedules(context.Background(), day).Wait()
+	bot.tickSchedules(context.Background(), day.Add(time.Minute)).Wait()
+	if text := response.text(); !strings.Contains(text, "Running schedule `morning`") || !strings.Contains(text, "hello team") {
+		t.Errorf("expected scheduled run but got %s", text)
+	}
+	if run := bot.History.Recent("greet", 1); len(run) != 1 || run[0].User != "schedule:morning" {
+		t.Errorf("expected scheduled run in history but got %+v", run)
+	}
+
+	admin := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "pause morning"}, admin)
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "schedules"}, admin)
+	if text := admin.text(); !strings.Contains(text, "paused by <@U1>") {
+		t.Errorf("expected schedule to be paused but got %s", text)
+	}
+}
@@ -0,0 +1,260 @@
+package slackchatops
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// SecretsKeyEnv is the environment variable holding the hex encoded key of the SecretsFile
+const SecretsKeyEnv = "CHATOPS_SECRETS_KEY"
+
+// DefaultSecretsFile is used when the configuration doesn't set a SecretsFile
+const DefaultSecretsFile = "secrets.enc"
+
+// Prefixes of Env values read from somewhere else than the configuration
+const (
+	EnvFromEnv    = "env:"    // env:NAME is the value of NAME in the bot's environment
+	EnvFromFile   = "file:"   // file:path is the content of the file without the trailing newline
+	EnvFromSecret = "secret:" // secret:name is a value of the encrypted SecretsFile
+)
+
+const (
+	// masked replaces secret values in output, logs and history
+	masked = "********"
+	// minMaskedLength keeps very short values (ex: 1) from being masked everywhere they appear.
+	// Shorter secrets are rejected and shorter env or file values are logged
+	minMaskedLength = 4
+)
+
+// Secrets are named values stored in a file encrypted with AES-256-GCM so credentials
+// don't have to be written in the configuration
+type Secrets map[string]string
+
+// NewSecretsKey returns a random key for a secrets file, hex encoded as SecretsKeyEnv expects it
+func NewSecretsKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// ReadSecrets decrypts the secrets file at path with the hex encoded key. A missing file has no secrets
+func ReadSecrets(path string, key string) (Secrets, error) {
+	secrets := Secrets{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := secretsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Secrets file %s is not valid", path)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt %s. Check %s", path, SecretsKeyEnv)
+	}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("Secrets file %s is not valid: %v", path, err)
+	}
+	return secrets, nil
+}
+
+// Write encrypts the secrets with the hex encoded key and saves them to path
+func (s Secrets) Write(path string, key string) error {
+	gcm, err := secretsCipher(key)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(sealed)+"\n"), 0600)
+}
+
+func secretsCipher(key string) (cipher.AEAD, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%s must be 64 hex characters", SecretsKeyEnv)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// environment resolves Env values. The secrets file is only read the first time a secret is used
+type environment struct {
+	config  *Config
+	secrets Secrets
+	hidden  []string // every value read from the environment, a file or the secrets file
+	short   []string // names of the hidden values too short to be masked
+}
+
+// resolve returns the variables as NAME=value sorted by name
+func (e *environment) resolve(env map[string]string) ([]string, []string, error) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars, hidden := []string{}, []string{}
+	for _, name := range names {
+		value := env[name]
+		switch {
+		case strings.HasPrefix(value, EnvFromEnv):
+			key := strings.TrimPrefix(value, EnvFromEnv)
+			v, ok := os.LookupEnv(key)
+			if !ok {
+				return nil, nil, fmt.Errorf("Env %s needs %s which is not set", name, key)
+			}
+			value = v
+			hidden = append(hidden, value)
+			if len(value) < minMaskedLength {
+				e.short = append(e.short, name)
+			}
+		case strings.HasPrefix(value, EnvFromFile):
+			path, _ := ExpandPath(strings.TrimPrefix(value, EnvFromFile))
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Env %s: %v", name, err)
+			}
+			value = strings.TrimRight(string(data), "\r\n")
+			hidden = append(hidden, value)
+			if len(value) < minMaskedLength {
+				e.short = append(e.short, name)
+			}
+		case strings.HasPrefix(value, EnvFromSecret):
+			if e.secrets == nil {
+				path, _ := ExpandPath(e.config.secretsFile())
+				secrets, err := ReadSecrets(path, os.Getenv(SecretsKeyEnv))
+				if err != nil {
+					return nil, nil, err
+				}
+				e.secrets = secrets
+			}
+			key := strings.TrimPrefix(value, EnvFromSecret)
+			v, ok := e.secrets[key]
+			if !ok {
+				return nil, nil, fmt.Errorf("Env %s needs secret %s which is not in %s", name, key, e.config.secretsFile())
+			}
+			if len(v) < minMaskedLength {
+				return nil, nil, fmt.Errorf("Env %s needs secret %s which is shorter than %d characters so it can't be masked", name, key, minMaskedLength)
+			}
+			value = v
+			hidden = append(hidden, value)
+		}
+		vars = append(vars, name+"="+value)
+	}
+	e.hidden = append(e.hidden, hidden...)
+	return vars, hidden, nil
+}
+
+// secretsFile returns the path of the encrypted secrets file
+func (c *Config) secretsFile() string {
+	if c.SecretsFile != "" {
+		return c.SecretsFile
+	}
+	return DefaultSecretsFile
+}
+
+// masker replaces secret values with ********
+type masker struct {
+	replacer *strings.Replacer
+}
+
+// newMasker masks the values, longest first so a secret containing another is masked whole
+func newMasker(values []string) *masker {
+	sorted := []string{}
+	for _, v := range values {
+		if len(v) >= minMaskedLength {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	pairs := []string{}
+	for _, v := range sorted {
+		pairs = append(pairs, v, masked)
+	}
+	return &masker{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Mask returns the text without any secret. A nil masker has nothing to hide
+func (m *masker) Mask(text string) string {
+	if m == nil {
+		return text
+	}
+	return m.replacer.Replace(text)
+}
+
+// maskHook removes the secrets of the active configuration from every log entry. The masker
+// is swapped on reload without taking the bot's lock since anything may log
+type maskHook struct {
+	masker atomic.Value
+}
+
+func (h *maskHook) set(m *masker) {
+	h.masker.Store(m)
+}
+
+func (h *maskHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *maskHook) Fire(entry *logrus.Entry) error {
+	m, _ := h.masker.Load().(*masker)
+	if m == nil {
+		return nil
+	}
+	entry.Message = m.Mask(entry.Message)
+	// the fields may be shared with other entries so the masked ones go to a copy
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			value = m.Mask(v)
+		case []string:
+			values := make([]string, len(v))
+			for i := range v {
+				values[i] = m.Mask(v[i])
+			}
+			value = values
+		case error:
+			value = m.Mask(v.Error())
+		}
+		data[key] = value
+	}
+	entry.Data = data
+	return nil
+}
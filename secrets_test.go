@@ -0,0 +1,160 @@
+package slackchatops
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretsRoundTrip(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "secrets")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.enc")
+	key, err := NewSecretsKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (Secrets{"db": "hunter22"}).Write(path, key); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); bytes.Contains(data, []byte("hunter22")) {
+		t.Errorf("expected the file to be encrypted but got %s", data)
+	}
+	secrets, err := ReadSecrets(path, key)
+	if err != nil || secrets["db"] != "hunter22" {
+		t.Errorf("expected the secret back but got %v %v", secrets, err)
+	}
+
+	other, _ := NewSecretsKey()
+	if _, err := ReadSecrets(path, other); err == nil {
+		t.Error("expected the wrong key to fail")
+	}
+	if _, err := ReadSecrets(path, "short"); err == nil {
+		t.Error("expected an invalid key to fail")
+	}
+	if secrets, err := ReadSecrets(filepath.Join(dir, "missing"), key); err != nil || len(secrets) != 0 {
+		t.Errorf("expected a missing file to have no secrets but got %v %v", secrets, err)
+	}
+}
+
+func TestMasker(t *testing.T) {
+	m := newMasker([]string{"abc", "token", "token-long"})
+	if masked := m.Mask("token-long token abc"); masked != "******** ******** abc" {
+		t.Errorf("unexpected masked text %q", masked)
+	}
+	var none *masker
+	if text := none.Mask("token"); text != "token" {
+		t.Errorf("expected a nil masker to keep the text but got %q", text)
+	}
+}
+
+func TestBotPassesEnvAndMasksSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir, _ := ioutil.TempDir("", "env")
+	defer os.RemoveAll(dir)
+	key, _ := NewSecretsKey()
+	os.Setenv(SecretsKeyEnv, key)
+	defer os.Unsetenv(SecretsKeyEnv)
+	secretsFile := filepath.Join(dir, "secrets.enc")
+	if err := (Secrets{"db": "hunter22"}).Write(secretsFile, key); err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600)
+
+	bot, cleanup := newTestBot(t, &Config{
+		SecretsFile: secretsFile,
+		Env:         map[string]string{"REGION": "eu-west-1", "DB_PASSWORD": "secret:db"},
+		Actions: []Action{
+			{Name: "leak", Command: "sh", Args: []string{"-c", "echo $REGION $DB_PASSWORD $TOKEN; echo $DB_PASSWORD >&2; exit 1"},
+				Env: map[string]string{"TOKEN": "file:" + tokenFile, "REGION": "us-east-1"}},
+		},
+	})
+	defer cleanup()
+	var logs bytes.Buffer
+	bot.Log.Logger.Out = &logs
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "leak"}, response)
+	text := response.text()
+	if !strings.Contains(text, "us-east-1 ******** ********") || strings.Contains(text, "hunter22") || strings.Contains(text, "file-token") {
+		t.Errorf("expected env with masked secrets but got %s", text)
+	}
+	runs := bot.History.Recent("leak", 1)
+	if len(runs) != 1 || strings.Contains(runs[0].StdOut+runs[0].StdError, "hunter22") {
+		t.Errorf("expected masked history but got %+v", runs)
+	}
+
+	bot.Log.WithField("password", "hunter22").Error("login hunter22 failed")
+	if strings.Contains(logs.String(), "hunter22") || !strings.Contains(logs.String(), "login ******** failed") {
+		t.Errorf("expected masked logs but got %s", logs.String())
+	}
+}
+
+func TestBotRejectsMissingSecrets(t *testing.T) {
+	bot, cleanup := newTestBot(t, &Config{})
+	defer cleanup()
+	err := bot.Load(&Config{Actions: []Action{{Name: "a", Command: "true", Env: map[string]string{"X": "env:CHATOPS_TEST_MISSING"}}}})
+	if err == nil || !strings.Contains(err.Error(), "CHATOPS_TEST_MISSING") {
+		t.Errorf("expected missing variable error but got %v", err)
+	}
+}
+
+func TestBotRejectsShortSecrets(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "short")
+	defer os.RemoveAll(dir)
+	key, _ := NewSecretsKey()
+	os.Setenv(SecretsKeyEnv, key)
+	defer os.Unsetenv(SecretsKeyEnv)
+	secretsFile := filepath.Join(dir, "secrets.enc")
+	(Secrets{"pin": "123"}).Write(secretsFile, key)
+	os.Setenv("CHATOPS_TEST_SHORT", "ab")
+	defer os.Unsetenv("CHATOPS_TEST_SHORT")
+
+	bot, cleanup := newTestBot(t, &Config{})
+	defer cleanup()
+	var logs bytes.Buffer
+	bot.Log.Logger.Out = &logs
+
+	err := bot.Load(&Config{SecretsFile: secretsFile, Actions: []Action{{Name: "a", Command: "true", Env: map[string]string{"PIN": "secret:pin"}}}})
+	if err == nil || !strings.Contains(err.Error(), "can't be masked") {
+		t.Errorf("expected a short secret to be rejected but got %v", err)
+	}
+	if err := bot.Load(&Config{Actions: []Action{{Name: "a", Command: "true", Env: map[string]string{"PORT": "env:CHATOPS_TEST_SHORT"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "EnvTooShortToMask") || !strings.Contains(logs.String(), "env=PORT") {
+		t.Errorf("expected a warning about the short value but got %s", logs.String())
+	}
+}
+
+func TestBotMasksStreamedSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	dir, _ := ioutil.TempDir("", "stream")
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	ioutil.WriteFile(keyFile, []byte("-----BEGIN KEY-----\nc2VjcmV0\n-----END KEY-----\n"), 0600)
+
+	bot, cleanup := newTestBot(t, &Config{StreamInterval: 10 * time.Millisecond, Actions: []Action{
+		{Name: "leak", Command: "sh", Args: []string{"-c", `printf '%s\n' "$KEY"`}, Stream: true, Env: map[string]string{"KEY": "file:" + keyFile}},
+	}})
+	defer cleanup()
+
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "leak"}, response)
+	edits := strings.Join(response.edits, "\n")
+	if strings.Contains(edits, "c2VjcmV0") || !strings.Contains(edits, "********") {
+		t.Errorf("expected the multi line secret to be masked but got %s", edits)
+	}
+}
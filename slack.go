@@ -0,0 +1,196 @@
+package slackchatops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/nlopes/slack"
+)
+
+// SlackResponder replies to a Slack message through the web API. It works with every
+// transport since it doesn't need the RTM connection
+type SlackResponder struct {
+	Client   *slack.Client
+	Channel  string
+	Message  string // timestamp of the message being answered. Reactions are added to it
+	ThreadTS string // timestamp of the thread replies are posted in, if any
+	Token    string // bot token used to upload files into threads, which the client can't do
+}
+
+// NewSlackResponder creates a responder posting to channel
+func NewSlackResponder(client *slack.Client, channel string) *SlackResponder {
+	return &SlackResponder{Client: client, Channel: channel}
+}
+
+// NewMessageResponder creates a responder answering the message. Messages sent in a thread are answered in it
+func NewMessageResponder(client *slack.Client, token string, message Message) *SlackResponder {
+	return &SlackResponder{Client: client, Channel: message.Channel, Message: message.ID, ThreadTS: message.Thread, Token: token}
+}
+
+// params returns the parameters shared by every message posted by the responder
+func (r *SlackResponder) params() slack.PostMessageParameters {
+	params := slack.PostMessageParameters{AsUser: true}
+	if r.ThreadTS != "" {
+		params.ThreadTimestamp = r.ThreadTS
+	}
+	return params
+}
+
+// Reply posts a message and returns its timestamp so it can be edited
+func (r *SlackResponder) Reply(text string) (string, error) {
+	_, ts, err := r.Client.PostMessage(r.Channel, text, r.params())
+	return ts, err
+}
+
+// Alert posts a colored attachment
+func (r *SlackResponder) Alert(color string, title string, text string) error {
+	params := r.params()
+	params.Attachments = []slack.Attachment{{Color: color, Title: title, Text: text}}
+	_, _, err := r.Client.PostMessage(r.Channel, "", params)
+	return err
+}
+
+// Buttons posts an attachment with buttons. Clicks are received by the InteractionHandler
+func (r *SlackResponder) Buttons(text string, buttons []Button) error {
+	params := r.params()
+	params.Attachments = []slack.Attachment{buttonAttachment(buttons)}
+	_, _, err := r.Client.PostMessage(r.Channel, text, params)
+	return err
+}
+
+// Fields posts a colored attachment with fields
+func (r *SlackResponder) Fields(color string, text string, fields []Field) error {
+	params := r.params()
+	params.Attachments = []slack.Attachment{fieldsAttachment(color, fields)}
+	_, _, err := r.Client.PostMessage(r.Channel, text, params)
+	return err
+}
+
+// Edit replaces the text of a message posted by Reply
+func (r *SlackResponder) Edit(id string, text string) error {
+	_, _, _, err := r.Client.UpdateMessage(r.Channel, id, text)
+	return err
+}
+
+// Upload shares a file in the channel, or thread, the message came from. Responders without a
+// token share files of threaded replies in the channel since the client can't upload into a thread
+func (r *SlackResponder) Upload(path string, title string) error {
+	if r.ThreadTS == "" || r.Token == "" {
+		_, err := r.Client.UploadFile(slack.FileUploadParameters{File: path, Title: title, Channels: []string{r.Channel}})
+		return err
+	}
+	return UploadFile("", r.Token, r.Channel, r.ThreadTS, path, title)
+}
+
+// UploadFile calls files.upload directly to share a file in a thread of the channel. apiURL
+// defaults to slack.SLACK_API
+func UploadFile(apiURL string, token string, channel string, thread string, path string, title string) error {
+	if apiURL == "" {
+		apiURL = slack.SLACK_API
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("channels", channel)
+	form.WriteField("thread_ts", thread)
+	form.WriteField("title", title)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", apiURL+"files.upload", &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	request.Header.Set("Authorization", "Bearer "+token)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("files.upload failed: %s", result.Error)
+	}
+	return nil
+}
+
+// Typing does nothing since the web API has no typing indicator
+func (r *SlackResponder) Typing() {}
+
+// Thread returns a responder replying in a thread under the message. Replies already going to
+// a thread stay in it
+func (r *SlackResponder) Thread() Responder {
+	if r.ThreadTS != "" || r.Message == "" {
+		return r
+	}
+	thread := *r
+	thread.ThreadTS = r.Message
+	return &thread
+}
+
+// React adds a reaction to the message
+func (r *SlackResponder) React(emoji string) error {
+	if r.Message == "" {
+		return nil
+	}
+	return r.Client.AddReaction(emoji, slack.NewRefToMessage(r.Channel, r.Message))
+}
+
+// Unreact removes a reaction from the message
+func (r *SlackResponder) Unreact(emoji string) error {
+	if r.Message == "" {
+		return nil
+	}
+	return r.Client.RemoveReaction(emoji, slack.NewRefToMessage(r.Channel, r.Message))
+}
+
+// fieldsAttachment turns fields into a colored attachment
+func fieldsAttachment(color string, fields []Field) slack.Attachment {
+	attachment := slack.Attachment{Color: color}
+	for _, field := range fields {
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{Title: field.Title, Value: field.Value, Short: field.Short})
+	}
+	return attachment
+}
+
+// buttonAttachment turns buttons into an interactive message attachment
+func buttonAttachment(buttons []Button) slack.Attachment {
+	attachment := slack.Attachment{CallbackID: buttonCallbackID, Fallback: "Type the command instead"}
+	for _, button := range buttons {
+		attachment.Actions = append(attachment.Actions, slack.AttachmentAction{
+			Name:  "command",
+			Text:  button.Label,
+			Type:  "button",
+			Value: button.Command,
+			Style: button.Style,
+		})
+	}
+	return attachment
+}
@@ -0,0 +1,43 @@
+package slackchatops
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "upload")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.html")
+	ioutil.WriteFile(path, []byte("<h1>ok</h1>"), 0644)
+
+	var channel, thread, content string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/files.upload" || r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+		r.ParseMultipartForm(1 << 20)
+		channel, thread = r.FormValue("channels"), r.FormValue("thread_ts")
+		if f, _, err := r.FormFile("file"); err == nil {
+			data, _ := ioutil.ReadAll(f)
+			content = string(data)
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	if err := UploadFile(server.URL+"/api/", "xoxb-test", "C1", "1.5", path, "report.html"); err != nil {
+		t.Fatal(err)
+	}
+	if channel != "C1" || thread != "1.5" || content != "<h1>ok</h1>" {
+		t.Errorf("unexpected upload %s %s %s", channel, thread, content)
+	}
+	if err := UploadFile(server.URL+"/api/", "wrong", "C1", "1.5", path, "report.html"); err == nil {
+		t.Error("expected the upload to fail with a wrong token")
+	}
+}
@@ -0,0 +1,185 @@
+package slackchatops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	logrus "github.com/sirupsen/logrus"
+)
+
+// SlashHandler receives Slack slash commands (ex: `/ops deploy api 1.4`). The request is
+// acknowledged right away and replies are posted to its response_url once the command runs
+type SlashHandler struct {
+	SigningSecret string
+	Command       string // the slash command to accept (ex: /ops). Any command when empty
+	Client        *slack.Client
+	Handle        func(message Message, response Responder)
+	Log           *logrus.Entry
+}
+
+// ServeHTTP verifies the request, acknowledges it and dispatches its text in the background
+func (h *SlashHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := VerifySignature(h.SigningSecret, r.Header, body, time.Now()); err != nil {
+		h.Log.WithFields(logrus.Fields{"remote": r.RemoteAddr}).Warn(err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.Command != "" && form.Get("command") != h.Command {
+		http.Error(w, "Unknown command "+form.Get("command"), http.StatusNotFound)
+		return
+	}
+
+	message := Message{User: form.Get("user_id"), Channel: form.Get("channel_id"), Text: form.Get("text"), Slash: true, Trigger: form.Get("trigger_id")}
+	response := &ResponseURLResponder{URL: form.Get("response_url"), Fallback: NewSlackResponder(h.Client, message.Channel)}
+	go h.Handle(message, response)
+
+	// echo the command in the channel so everyone sees what was run
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"response_type":"in_channel"}`))
+}
+
+// ResponseURLResponder replies to a slash command through its response_url. Slack only accepts
+// a few messages per response_url so replies go through Fallback once it refuses them
+type ResponseURLResponder struct {
+	URL      string
+	Fallback Responder
+
+	mu       sync.Mutex
+	ids      int
+	failed   bool
+	fallback map[string]string // ids of replies posted by the fallback
+}
+
+type responseMessage struct {
+	Text            string             `json:"text"`
+	ResponseType    string             `json:"response_type"`
+	ReplaceOriginal bool               `json:"replace_original,omitempty"`
+	Attachments     []slack.Attachment `json:"attachments,omitempty"`
+}
+
+// Reply posts a message visible to the whole channel
+func (r *ResponseURLResponder) Reply(text string) (string, error) {
+	r.mu.Lock()
+	r.ids++
+	id := strconv.Itoa(r.ids)
+	r.mu.Unlock()
+
+	if r.post(responseMessage{Text: text, ResponseType: "in_channel"}) == nil {
+		return id, nil
+	}
+	ts, err := r.Fallback.Reply(text)
+	r.mu.Lock()
+	if r.fallback == nil {
+		r.fallback = map[string]string{}
+	}
+	r.fallback[id] = ts
+	r.mu.Unlock()
+	return id, err
+}
+
+// Alert posts a colored attachment
+func (r *ResponseURLResponder) Alert(color string, title string, text string) error {
+	message := responseMessage{ResponseType: "in_channel", Attachments: []slack.Attachment{{Color: color, Title: title, Text: text}}}
+	if r.post(message) == nil {
+		return nil
+	}
+	return r.Fallback.Alert(color, title, text)
+}
+
+// Buttons posts a message with buttons
+func (r *ResponseURLResponder) Buttons(text string, buttons []Button) error {
+	message := responseMessage{Text: text, ResponseType: "in_channel", Attachments: []slack.Attachment{buttonAttachment(buttons)}}
+	if r.post(message) == nil {
+		return nil
+	}
+	return r.Fallback.Buttons(text, buttons)
+}
+
+// Fields posts a message with key/value fields
+func (r *ResponseURLResponder) Fields(color string, text string, fields []Field) error {
+	message := responseMessage{Text: text, ResponseType: "in_channel", Attachments: []slack.Attachment{fieldsAttachment(color, fields)}}
+	if r.post(message) == nil {
+		return nil
+	}
+	return r.Fallback.Fields(color, text, fields)
+}
+
+// Edit replaces the last message posted through the response_url
+func (r *ResponseURLResponder) Edit(id string, text string) error {
+	r.mu.Lock()
+	ts, ok := r.fallback[id]
+	r.mu.Unlock()
+	if ok {
+		return r.Fallback.Edit(ts, text)
+	}
+	return r.post(responseMessage{Text: text, ResponseType: "in_channel", ReplaceOriginal: true})
+}
+
+// Upload shares the file through the fallback since response_url can't take files
+func (r *ResponseURLResponder) Upload(path string, title string) error {
+	return r.Fallback.Upload(path, title)
+}
+
+// Typing does nothing since slash commands have no typing indicator
+func (r *ResponseURLResponder) Typing() {}
+
+// Thread returns the responder itself since a slash command has no message to thread under
+func (r *ResponseURLResponder) Thread() Responder {
+	return r
+}
+
+// React does nothing since a slash command has no message to react to
+func (r *ResponseURLResponder) React(emoji string) error {
+	return nil
+}
+
+// Unreact does nothing since a slash command has no message to react to
+func (r *ResponseURLResponder) Unreact(emoji string) error {
+	return nil
+}
+
+// post sends the message to the response_url. Once it was refused every later reply uses the fallback
+func (r *ResponseURLResponder) post(message responseMessage) error {
+	r.mu.Lock()
+	failed := r.failed
+	r.mu.Unlock()
+	if failed {
+		return fmt.Errorf("response_url no longer accepts messages")
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	response, err := http.Post(r.URL, "application/json", bytes.NewReader(body))
+	if err == nil {
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			err = fmt.Errorf("response_url returned %s", response.Status)
+		}
+	}
+	if err != nil {
+		r.mu.Lock()
+		r.failed = true
+		r.mu.Unlock()
+	}
+	return err
+}
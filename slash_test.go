@@ -0,0 +1,115 @@
+package slackchatops
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResponseURL records messages posted to a slash command's response_url
+type fakeResponseURL struct {
+	mu       sync.Mutex
+	messages []responseMessage
+	limit    int
+}
+
+func (f *fakeResponseURL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.limit > 0 && len(f.messages) >= f.limit {
+		http.Error(w, "used_url", http.StatusNotFound)
+		return
+	}
+	var message responseMessage
+	json.NewDecoder(r.Body).Decode(&message)
+	f.messages = append(f.messages, message)
+}
+
+func (f *fakeResponseURL) texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	texts := []string{}
+	for _, m := range f.messages {
+		texts = append(texts, m.Text)
+	}
+	return texts
+}
+
+func TestSlashCommandRunsAction(t *testing.T) {
+	responseURL := &fakeResponseURL{}
+	server := httptest.NewServer(responseURL)
+	defer server.Close()
+
+	bot, cleanup := newTestBot(t, &Config{SlackChannel: "COPS", Actions: []Action{
+		{Name: "deploy", Command: "echo", Args: []string{"{0}", "{1}"}, Params: []Param{{Name: "app"}, {Name: "version"}}},
+	}})
+	defer cleanup()
+	done := make(chan struct{})
+	handler := &SlashHandler{
+		SigningSecret: "secret",
+		Command:       "/ops",
+		Handle: func(m Message, r Responder) {
+			bot.Handle(context.Background(), m, r)
+			close(done)
+		},
+		Log: NewLogger("test"),
+	}
+
+	form := url.Values{"command": {"/ops"}, "text": {"deploy api 1.4"}, "user_id": {"U1"}, "channel_id": {"CANY"}, "response_url": {server.URL}}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, signedRequest("secret", form.Encode(), time.Now()))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "in_channel") {
+		t.Errorf("expected immediate in_channel ack but got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not handled")
+	}
+	if texts := strings.Join(responseURL.texts(), "\n"); !strings.Contains(texts, "api 1.4") || !strings.Contains(texts, "ExitCode: 0") {
+		t.Errorf("expected result posted to response_url but got %s", texts)
+	}
+}
+
+func TestSlashCommandRejectsBadSignatureAndOtherCommands(t *testing.T) {
+	handler := &SlashHandler{SigningSecret: "secret", Command: "/ops", Log: NewLogger("test")}
+	form := url.Values{"command": {"/ops"}, "text": {"help"}}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, signedRequest("wrong", form.Encode(), time.Now()))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 but got %d", recorder.Code)
+	}
+
+	form.Set("command", "/other")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, signedRequest("secret", form.Encode(), time.Now()))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 but got %d", recorder.Code)
+	}
+}
+
+func TestResponseURLFallsBack(t *testing.T) {
+	responseURL := &fakeResponseURL{limit: 1}
+	server := httptest.NewServer(responseURL)
+	defer server.Close()
+
+	fallback := &fakeResponder{}
+	response := &ResponseURLResponder{URL: server.URL, Fallback: fallback}
+	response.Reply("one")
+	response.Reply("two")
+	response.Reply("three")
+	if texts := responseURL.texts(); len(texts) != 1 || texts[0] != "one" {
+		t.Errorf("expected only the first reply on response_url but got %v", texts)
+	}
+	if len(fallback.replies) != 2 || fallback.replies[1] != "three" {
+		t.Errorf("expected later replies through the fallback but got %v", fallback.replies)
+	}
+}
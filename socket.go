@@ -0,0 +1,136 @@
+package slackchatops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	logrus "github.com/sirupsen/logrus"
+)
+
+const (
+	socketMinBackoff = time.Second
+	socketMaxBackoff = 30 * time.Second
+)
+
+// socketEnvelope wraps everything Slack sends over a Socket Mode connection
+type socketEnvelope struct {
+	EnvelopeID string          `json:"envelope_id"`
+	Type       string          `json:"type"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// SocketMode receives Slack events over a websocket opened with an app level token (xapp-...).
+// Unlike the Events API it doesn't need a public HTTP endpoint
+type SocketMode struct {
+	AppToken string
+	APIURL   string // defaults to https://slack.com/api/
+	Handle   func(message Message)
+	Log      *logrus.Entry
+}
+
+// Run keeps a connection open until the context is done, reconnecting whenever Slack
+// closes it or it fails
+func (s *SocketMode) Run(ctx context.Context) error {
+	backoff := socketMinBackoff
+	for {
+		err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			backoff = socketMinBackoff
+			continue
+		}
+		s.Log.WithFields(logrus.Fields{"retry": backoff}).Warn("Socket mode connection failed: ", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > socketMaxBackoff {
+			backoff = socketMaxBackoff
+		}
+	}
+}
+
+// connect reads envelopes from one connection. It returns nil when Slack asks to reconnect
+func (s *SocketMode) connect(ctx context.Context) error {
+	url, err := s.openURL(ctx)
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		var envelope socketEnvelope
+		if err := conn.ReadJSON(&envelope); err != nil {
+			return err
+		}
+		if envelope.EnvelopeID != "" {
+			if err := conn.WriteJSON(map[string]string{"envelope_id": envelope.EnvelopeID}); err != nil {
+				return err
+			}
+		}
+
+		switch envelope.Type {
+		case "hello":
+			s.Log.Info("SocketModeConnected")
+		case "disconnect":
+			s.Log.WithFields(logrus.Fields{"reason": envelope.Reason}).Info("SocketModeReconnect")
+			return nil
+		case "events_api":
+			var callback eventCallback
+			if err := json.Unmarshal(envelope.Payload, &callback); err != nil {
+				s.Log.Warn(err)
+				continue
+			}
+			if message, ok := callback.message(); ok {
+				go s.Handle(message)
+			}
+		}
+	}
+}
+
+// openURL asks Slack for the websocket URL of a new connection
+func (s *SocketMode) openURL(ctx context.Context) (string, error) {
+	apiURL := s.APIURL
+	if apiURL == "" {
+		apiURL = "https://slack.com/api/"
+	}
+	request, err := http.NewRequest("POST", apiURL+"apps.connections.open", nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+s.AppToken)
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		URL   string `json:"url"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if !result.OK {
+		return "", fmt.Errorf("apps.connections.open failed: %s", result.Error)
+	}
+	return result.URL, nil
+}
@@ -0,0 +1,120 @@
+package slackchatops
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+)
+
+// fakeSlack serves the Slack endpoints the bot uses and records what it posts
+type fakeSlack struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	posted []string
+	acks   chan string
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{acks: make(chan string, 10)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xapp-test" {
+			w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"url":"ws` + strings.TrimPrefix(f.server.URL, "http") + `/socket"}`))
+	})
+	mux.HandleFunc("/api/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		f.mu.Lock()
+		f.posted = append(f.posted, r.Form.Get("channel")+": "+r.Form.Get("text"))
+		f.mu.Unlock()
+		w.Write([]byte(`{"ok":true,"channel":"` + r.Form.Get("channel") + `","ts":"1.0"}`))
+	})
+	mux.HandleFunc("/socket", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(map[string]string{"type": "hello"})
+		conn.WriteJSON(map[string]interface{}{
+			"envelope_id": "e1",
+			"type":        "events_api",
+			"payload":     json.RawMessage(`{"type":"event_callback","event":{"type":"app_mention","user":"U1","channel":"C1","text":"<@UBOT> help"}}`),
+		})
+		var ack map[string]string
+		if err := conn.ReadJSON(&ack); err == nil {
+			f.acks <- ack["envelope_id"]
+		}
+		conn.ReadMessage() // hold the connection open until the client goes away
+	})
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeSlack) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.posted...)
+}
+
+func TestSocketModeAgainstFakeSlack(t *testing.T) {
+	fake := newFakeSlack(t)
+	defer fake.server.Close()
+	api := slack.SLACK_API
+	slack.SLACK_API = fake.server.URL + "/api/"
+	defer func() { slack.SLACK_API = api }()
+
+	bot, cleanup := newTestBot(t, &Config{})
+	defer cleanup()
+	client := slack.New("xoxb-test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := &SocketMode{
+		AppToken: "xapp-test",
+		APIURL:   fake.server.URL + "/api/",
+		Handle: func(m Message) {
+			bot.Handle(ctx, m, NewSlackResponder(client, m.Channel))
+		},
+		Log: NewLogger("test"),
+	}
+	go socket.Run(ctx)
+
+	select {
+	case id := <-fake.acks:
+		if id != "e1" {
+			t.Errorf("expected envelope e1 to be acknowledged but got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("envelope was not acknowledged")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if posted := fake.messages(); len(posted) != 1 || !strings.HasPrefix(posted[0], "C1: ") || !strings.Contains(posted[0], "`help <action>`") {
+		t.Errorf("expected help to be posted to C1 but got %v", posted)
+	}
+}
+
+func TestSocketModeInvalidToken(t *testing.T) {
+	fake := newFakeSlack(t)
+	defer fake.server.Close()
+
+	socket := &SocketMode{AppToken: "xapp-wrong", APIURL: fake.server.URL + "/api/", Log: NewLogger("test")}
+	if _, err := socket.openURL(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid_auth") {
+		t.Errorf("expected invalid_auth error but got %v", err)
+	}
+}
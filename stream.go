@@ -0,0 +1,70 @@
+package slackchatops
+
+import (
+	"bytes"
+	"strings"
+)
+
+// lineWriter splits everything written to it into lines and sends them to a channel.
+// stdout and stderr each get their own writer so partial lines aren't mixed together
+type lineWriter struct {
+	buf   []byte
+	lines chan<- string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.lines <- strings.TrimRight(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush sends any trailing output that didn't end with a newline
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.lines <- strings.TrimRight(string(w.buf), "\r")
+		w.buf = nil
+	}
+}
+
+// Tail keeps the last few lines added to it
+type Tail struct {
+	size  int
+	lines []string
+	total int
+}
+
+// NewTail creates a Tail holding at most size lines
+func NewTail(size int) *Tail {
+	return &Tail{size: size}
+}
+
+// Add appends a line, dropping the oldest one when full
+func (t *Tail) Add(line string) {
+	t.total++
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.size {
+		t.lines = t.lines[len(t.lines)-t.size:]
+	}
+}
+
+// Lines returns the lines currently held
+func (t *Tail) Lines() []string {
+	return t.lines
+}
+
+// Total returns how many lines have been added overall
+func (t *Tail) Total() int {
+	return t.total
+}
+
+// String joins the held lines with newlines
+func (t *Tail) String() string {
+	return strings.Join(t.lines, "\n")
+}
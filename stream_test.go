@@ -0,0 +1,48 @@
+package slackchatops
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestRunStream(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	action := Action{Name: "Foo", Command: "sh", Args: []string{"-c", "echo one; echo two >&2; printf three"}}
+	lines := make(chan string)
+	var received []string
+	done := make(chan struct{})
+	go func() {
+		for line := range lines {
+			received = append(received, line)
+		}
+		close(done)
+	}()
+	result, err := action.RunStream(context.Background(), lines)
+	<-done
+
+	if err != nil {
+		t.Error(err)
+	}
+	if len(received) != 3 || received[2] != "three" {
+		t.Errorf("Unexpected streamed lines %v", received)
+	}
+	if result.StdOut != "one\nthree" {
+		t.Error("Stdout was not captured while streaming")
+	}
+}
+
+func TestTail(t *testing.T) {
+	tail := NewTail(2)
+	tail.Add("a")
+	tail.Add("b")
+	tail.Add("c")
+	if tail.String() != "b\nc" {
+		t.Errorf("Unexpected tail %q", tail.String())
+	}
+	if tail.Total() != 3 {
+		t.Error("Expected 3 lines to be counted")
+	}
+}
@@ -0,0 +1,104 @@
+package slackchatops
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	slackLinkPattern = regexp.MustCompile(`<((?:https?|mailto|ftp):[^|>]*)(?:\|([^>]*))?>`)
+	slackEntities    = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+	smartQuotes      = strings.NewReplacer("“", `"`, "”", `"`, "„", `"`, "‘", "'", "’", "'")
+)
+
+// CommandArgs returns the arguments typed after the command name in a message.
+// The command name is matched the same way slacker matches commands (case insensitive whole word)
+func CommandArgs(text string, command string) ([]string, error) {
+	re := regexp.MustCompile(`(?i)(?:\s|^)` + regexp.QuoteMeta(command) + `(?:\s|$)`)
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return []string{}, nil
+	}
+	return SplitArgs(text[loc[1]:])
+}
+
+// SplitArgs tokenizes user input the way a shell would. Whitespace separates arguments,
+// single quotes keep everything literally, double quotes allow \" and \\ escapes and a
+// backslash outside of quotes escapes the next character. Slack's formatting (HTML entities,
+// auto-linked urls and smart quotes) is undone first so the arguments are what the user typed
+func SplitArgs(text string) ([]string, error) {
+	text = UnescapeSlack(text)
+	args := []string{}
+	var current strings.Builder
+	inArg := false
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case r == '\\':
+			inArg = true
+			if i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+			}
+		case r == '\'':
+			inArg = true
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated ' in arguments")
+			}
+			current.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inArg = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				current.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("Unterminated \" in arguments")
+			}
+		default:
+			inArg = true
+			current.WriteRune(r)
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// UnescapeSlack reverts the formatting Slack applies to message text. Links such as
+// <http://example.com|example.com> and <mailto:a@b.com|a@b.com> are replaced by the text the
+// user typed, smart quotes become plain quotes and HTML entities are decoded
+func UnescapeSlack(text string) string {
+	text = slackLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		m := slackLinkPattern.FindStringSubmatch(link)
+		if m[2] != "" {
+			return m[2]
+		}
+		return strings.TrimPrefix(m[1], "mailto:")
+	})
+	text = smartQuotes.Replace(text)
+	return slackEntities.Replace(text)
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,45 @@
+package slackchatops
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		args []string
+	}{
+		{`api  1.2`, []string{"api", "1.2"}},
+		{`"release 1.2" prod`, []string{"release 1.2", "prod"}},
+		{`'it''s' "say \"hi\""`, []string{"its", `say "hi"`}},
+		{`a\ b c`, []string{"a b", "c"}},
+		{`""`, []string{""}},
+		{`“smart quotes” ‘single’`, []string{"smart quotes", "single"}},
+		{`a &amp;&amp; b &lt;c&gt;`, []string{"a", "&&", "b", "<c>"}},
+		{`<http://example.com|example.com> <https://x.io/a?b=1>`, []string{"example.com", "https://x.io/a?b=1"}},
+		{`<mailto:bob@example.com|bob@example.com> <mailto:al@example.com>`, []string{"bob@example.com", "al@example.com"}},
+	}
+	for _, test := range tests {
+		args, err := SplitArgs(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: expected %q but got %q", test.text, test.args, args)
+		}
+	}
+}
+
+func TestSplitArgsUnterminatedQuote(t *testing.T) {
+	if _, err := SplitArgs(`"release 1.2`); err == nil {
+		t.Error("Expected error for unterminated quote")
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	args, _ := CommandArgs(`<@U0BOT> Deploy "release 1.2" prod`, "deploy")
+	if !reflect.DeepEqual(args, []string{"release 1.2", "prod"}) {
+		t.Errorf("Unexpected args %q", args)
+	}
+}
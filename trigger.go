@@ -0,0 +1,251 @@
+package slackchatops
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+const (
+	// TriggerPath is where triggers are served. The trigger's name follows it
+	TriggerPath = "/triggers/"
+	// TriggerSignatureHeader holds the HMAC-SHA256 of "<timestamp>:<body>" as sha256=<hex>
+	TriggerSignatureHeader = "X-Chatops-Signature"
+	// TriggerTimestampHeader holds the unix time the request was signed at
+	TriggerTimestampHeader = "X-Chatops-Timestamp"
+	// maxTriggerBody limits the size of a trigger request
+	maxTriggerBody = 1 << 20
+)
+
+// ErrUnauthorized is returned when a trigger request has neither a valid token nor a valid signature
+var ErrUnauthorized = errors.New("Invalid trigger token or signature")
+
+// Trigger lets other systems (ex: CI or monitoring) run an action over HTTP with POST /triggers/<name>
+type Trigger struct {
+	Name    string
+	Action  string // action or workflow to run
+	Secret  string // requests may sign their timestamp and body with HMAC-SHA256 in the X-Chatops-Signature header
+	Token   string // requests may send Authorization: Bearer <token>
+	Channel string // channel results are posted to. Defaults to SlackChannel
+}
+
+// Validate checks the trigger can authenticate requests and runs an action that needs no one to sign off
+func (t *Trigger) Validate(config *Config, find func(name string) *Action) error {
+	if t.Name == "" || strings.ContainsAny(t.Name, "/?#% ") {
+		return fmt.Errorf("Trigger for %s needs a name that can be used in a URL", t.Action)
+	}
+	if t.Secret == "" && t.Token == "" {
+		return fmt.Errorf("Trigger %s needs a secret or a token", t.Name)
+	}
+	if t.channel(config) == "" {
+		return fmt.Errorf("Trigger %s needs a channel to post to", t.Name)
+	}
+	a := find(t.Action)
+	if a == nil {
+		return fmt.Errorf("Trigger %s runs unknown action %s", t.Name, t.Action)
+	}
+	if a.Confirm.Enabled || a.RequiresApproval {
+		return fmt.Errorf("Trigger %s can't run %s because it needs confirmation or approval", t.Name, t.Action)
+	}
+	return nil
+}
+
+// Authenticate accepts requests with the trigger's bearer token or signed with its secret. Signed
+// requests older than maxSignatureAge are rejected so they can't be replayed
+func (t *Trigger) Authenticate(header http.Header, body []byte, now time.Time) error {
+	if auth := header.Get("Authorization"); t.Token != "" && strings.HasPrefix(auth, "Bearer ") {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(t.Token)) == 1 {
+			return nil
+		}
+	}
+	if t.Secret != "" {
+		timestamp := header.Get(TriggerTimestampHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return ErrUnauthorized
+		}
+		if age := now.Sub(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+			return ErrUnauthorized
+		}
+		mac := hmac.New(sha256.New, []byte(t.Secret))
+		mac.Write([]byte(timestamp + ":"))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if hmac.Equal([]byte(expected), []byte(header.Get(TriggerSignatureHeader))) {
+			return nil
+		}
+	}
+	return ErrUnauthorized
+}
+
+// channel returns where the trigger's results are posted
+func (t *Trigger) channel(config *Config) string {
+	if t.Channel != "" {
+		return t.Channel
+	}
+	return config.SlackChannel
+}
+
+// triggerRequest is the JSON body of a trigger request. Params set values by name and win over Args
+type triggerRequest struct {
+	Args   []string          `json:"args"`
+	Params map[string]string `json:"params"`
+	Wait   bool              `json:"wait"`
+}
+
+// values returns the values of the action's params in order
+func (t *triggerRequest) values(a *Action) ([]string, error) {
+	if len(t.Args) > len(a.Params) {
+		return nil, fmt.Errorf("Expected at most %d argument(s) but got %d", len(a.Params), len(t.Args))
+	}
+	values := make([]string, len(a.Params))
+	copy(values, t.Args)
+	for name, value := range t.Params {
+		found := false
+		for i, p := range a.Params {
+			if p.Name == name {
+				values[i], found = value, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s has no param %s", a.Name, name)
+		}
+	}
+	return a.ValidateParams(values)
+}
+
+// triggerResponse tells the caller which job runs the action and, when it waited, how it went
+type triggerResponse struct {
+	Job    string  `json:"job,omitempty"`
+	Result *Result `json:"result,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// TriggerHandler runs the action of a trigger and replies with the job id. With "wait": true in
+// the body (or ?wait=true) it only replies once the job finished, including its result
+type TriggerHandler struct {
+	Bot *Bot
+}
+
+// ServeHTTP authenticates the request and starts the trigger's action
+func (h *TriggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxTriggerBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b := h.Bot
+	b.mu.RLock()
+	s := b.setup
+	b.mu.RUnlock()
+	name := strings.TrimPrefix(r.URL.Path, TriggerPath)
+	var trigger *Trigger
+	for i := range s.config.Triggers {
+		if s.config.Triggers[i].Name == name {
+			trigger = &s.config.Triggers[i]
+		}
+	}
+	if trigger == nil {
+		http.Error(w, "Unknown trigger "+name, http.StatusNotFound)
+		return
+	}
+	if err := trigger.Authenticate(r.Header, body, time.Now()); err != nil {
+		b.Log.WithFields(logrus.Fields{"trigger": name, "remote": r.RemoteAddr}).Warn(err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var payload triggerRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			writeJSON(w, http.StatusBadRequest, triggerResponse{Error: err.Error()})
+			return
+		}
+	}
+	run, ok := s.runnables[trigger.Action]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, triggerResponse{Error: "Unknown action " + trigger.Action})
+		return
+	}
+	values, err := payload.values(&run.action)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, triggerResponse{Error: err.Error()})
+		return
+	}
+	if b.Responder == nil {
+		writeJSON(w, http.StatusServiceUnavailable, triggerResponse{Error: "No chat connection to post results to"})
+		return
+	}
+
+	channel := trigger.channel(s.config)
+	response := b.Responder(channel)
+	b.Log.WithFields(logrus.Fields{"trigger": name, "command": run.action.Name, "remote": r.RemoteAddr}).Info("Triggered")
+	response.Reply(fmt.Sprintf("Trigger `%s` is running `%s`", name, strings.TrimSpace(run.action.Name+" "+strings.Join(values, " "))))
+
+	// the job outlives the HTTP request unless the caller waits for it
+	request := &Request{Message: Message{User: "trigger:" + name, Channel: channel}, ctx: context.Background(), system: true}
+	jobs := make(chan *Job, 1)
+	done := make(chan triggerResponse, 1)
+	go func() {
+		result, err := b.runJob(run, request, values, response, func(job *Job) { jobs <- job })
+		finished := triggerResponse{Result: &result}
+		if err != nil {
+			finished.Error = err.Error()
+		}
+		done <- finished
+	}()
+
+	var job *Job
+	var finished *triggerResponse
+	select {
+	case job = <-jobs:
+	case f := <-done:
+		finished = &f
+		select {
+		case job = <-jobs:
+		default:
+		}
+	}
+	if job == nil {
+		writeJSON(w, http.StatusConflict, triggerResponse{Error: finished.Error})
+		return
+	}
+	if !payload.Wait && r.URL.Query().Get("wait") != "true" {
+		writeJSON(w, http.StatusAccepted, triggerResponse{Job: job.ID})
+		return
+	}
+	if finished == nil {
+		select {
+		case f := <-done:
+			finished = &f
+		case <-r.Context().Done():
+			return
+		}
+	}
+	finished.Job = job.ID
+	writeJSON(w, http.StatusOK, finished)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,148 @@
+package slackchatops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func triggerRequestFor(name string, body string) *http.Request {
+	return httptest.NewRequest("POST", TriggerPath+name, strings.NewReader(body))
+}
+
+func signTrigger(header http.Header, secret string, body string, at time.Time) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + ":" + body))
+	header.Set(TriggerTimestampHeader, timestamp)
+	header.Set(TriggerSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func newTriggerBot(t *testing.T) (*TriggerHandler, *fakeResponder, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bot, cleanup := newTestBot(t, &Config{
+		Actions: []Action{
+			{Name: "deploy", Command: "sh", Args: []string{"-c", "echo deploying {0} to {1}"}, Params: []Param{{Name: "version"}, {Name: "env", Default: "staging"}}},
+			{Name: "slow", Command: "sleep", Args: []string{"0.5"}},
+		},
+		Triggers: []Trigger{
+			{Name: "ci", Action: "deploy", Secret: "s3cret", Channel: "C1"},
+			{Name: "monitor", Action: "slow", Token: "t0ken", Channel: "C1"},
+		},
+	})
+	response := &fakeResponder{}
+	bot.Responder = func(channel string) Responder { return response }
+	return &TriggerHandler{Bot: bot}, response, cleanup
+}
+
+func TestTriggerAuthentication(t *testing.T) {
+	handler, _, cleanup := newTriggerBot(t)
+	defer cleanup()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, triggerRequestFor("ci", `{"args":["1.2"]}`))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a signature but got %d", recorder.Code)
+	}
+
+	request := triggerRequestFor("monitor", "")
+	request.Header.Set("Authorization", "Bearer wrong")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong token but got %d", recorder.Code)
+	}
+
+	body := `{"args":["1.2"]}`
+	request = triggerRequestFor("ci", body)
+	signTrigger(request.Header, "s3cret", body, time.Now().Add(-10*time.Minute))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a replayed signature but got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, triggerRequestFor("nope", ""))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown trigger but got %d", recorder.Code)
+	}
+}
+
+func TestTriggerRunsAction(t *testing.T) {
+	handler, response, cleanup := newTriggerBot(t)
+	defer cleanup()
+
+	body := `{"args":["1.2"],"params":{"env":"prod"},"wait":true}`
+	request := triggerRequestFor("ci", body)
+	signTrigger(request.Header, "s3cret", body, time.Now())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	var reply triggerResponse
+	json.Unmarshal(recorder.Body.Bytes(), &reply)
+	if recorder.Code != http.StatusOK || reply.Job == "" || reply.Result == nil || reply.Result.StdOut != "deploying 1.2 to prod\n" {
+		t.Errorf("unexpected reply %d %s", recorder.Code, recorder.Body.String())
+	}
+	if text := response.text(); !strings.Contains(text, "Trigger `ci` is running `deploy 1.2 prod`") || !strings.Contains(text, "ExitCode: 0") {
+		t.Errorf("expected result to be posted but got %s", text)
+	}
+	if run, ok := handler.Bot.History.Get(reply.Job); !ok || run.User != "trigger:ci" {
+		t.Errorf("expected run in history but got %+v", run)
+	}
+}
+
+func TestTriggerReturnsJob(t *testing.T) {
+	handler, _, cleanup := newTriggerBot(t)
+	defer cleanup()
+
+	send := func(body string) *httptest.ResponseRecorder {
+		request := triggerRequestFor("monitor", body)
+		request.Header.Set("Authorization", "Bearer t0ken")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	first := send("")
+	var reply triggerResponse
+	json.Unmarshal(first.Body.Bytes(), &reply)
+	if first.Code != http.StatusAccepted || reply.Job == "" {
+		t.Errorf("expected job id but got %d %s", first.Code, first.Body.String())
+	}
+	if _, ok := handler.Bot.Jobs.Get(reply.Job); !ok {
+		t.Errorf("expected job %s to be running", reply.Job)
+	}
+	if busy := send(""); busy.Code != http.StatusConflict {
+		t.Errorf("expected 409 while the action is running but got %d", busy.Code)
+	}
+	if invalid := send(`{"args":["extra"]}`); invalid.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too many args but got %d", invalid.Code)
+	}
+}
+
+func TestTriggerValidate(t *testing.T) {
+	config := &Config{Actions: []Action{{Name: "ls"}, {Name: "reboot", Confirm: Confirm{Enabled: true}}}}
+	find := func(name string) *Action { return config.FindAction(name) }
+	tests := []Trigger{
+		{Name: "a/b", Action: "ls", Token: "t", Channel: "C1"},
+		{Name: "noauth", Action: "ls", Channel: "C1"},
+		{Name: "nochannel", Action: "ls", Token: "t"},
+		{Name: "unknown", Action: "nope", Token: "t", Channel: "C1"},
+		{Name: "confirm", Action: "reboot", Token: "t", Channel: "C1"},
+	}
+	for _, trigger := range tests {
+		if err := trigger.Validate(config, find); err == nil {
+			t.Errorf("expected trigger %s to be invalid", trigger.Name)
+		}
+	}
+}
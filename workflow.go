@@ -0,0 +1,332 @@
+package slackchatops
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failure policies of a workflow step
+const (
+	OnFailureStop     = "stop"     // skip the remaining steps (default)
+	OnFailureContinue = "continue" // keep going with the next step
+	OnFailureRollback = "rollback" // run the step's Rollback and skip the remaining steps
+)
+
+// stepOutput matches references to the output of an earlier step, ex: {steps.build.stdout}
+var stepOutput = regexp.MustCompile(`\{steps\.([A-Za-z0-9_-]+)\.(stdout|stderr|exitcode)\}`)
+
+// Workflow runs several steps in order as one command. Its name, params, permissions,
+// confirmation, approvals and concurrency are set the same way as for an Action
+type Workflow struct {
+	Action `yaml:",inline"`
+	Steps  []Step
+}
+
+// Step of a workflow. It runs either an existing action or an inline command. Args may use
+// the workflow's params ({0}, {1}...) and the output of earlier steps ({steps.<name>.stdout},
+// {steps.<name>.stderr} or {steps.<name>.exitcode})
+type Step struct {
+	Name       string        // shown in the status message and used to reference the step's output. Defaults to the action name
+	Action     string        // name of the action to run. Args are its param values
+	Command    string        // inline command to run instead of an action
+	Args       []string      // param values of the action or arguments of the command
+	WorkingDir string        // working directory of an inline command
+	Timeout    time.Duration // maximum time an inline command may run
+	OnFailure  string        // stop (default), continue or rollback
+	Rollback   *Step         // step run when this one fails and OnFailure is rollback
+}
+
+// stepStatus icons shown in the workflow's status message
+const (
+	stepPending   = ":white_circle:"
+	stepRunning   = ":hourglass_flowing_sand:"
+	stepSucceeded = ":white_check_mark:"
+	stepFailed    = ":x:"
+	stepSkipped   = ":fast_forward:"
+	stepRolled    = ":leftwards_arrow_with_hook:"
+)
+
+// label returns the name of the step
+func (s *Step) label(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	if s.Action != "" {
+		return s.Action
+	}
+	return "step" + strconv.Itoa(i+1)
+}
+
+// Validate checks the workflow's definition against the actions of the configuration
+func (w *Workflow) Validate(config *Config) error {
+	// the workflow's params are used in the args of its steps
+	check := w.Action
+	check.Args = nil
+	for _, step := range w.Steps {
+		check.Args = append(check.Args, step.Args...)
+		if step.Rollback != nil {
+			check.Args = append(check.Args, step.Rollback.Args...)
+		}
+	}
+	if err := check.Validate(); err != nil {
+		return err
+	}
+	if w.Command != "" {
+		return fmt.Errorf("Workflow %s can't have a command, use steps", w.Name)
+	}
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("Workflow %s has no steps", w.Name)
+	}
+	seen := map[string]bool{}
+	for i := range w.Steps {
+		step := &w.Steps[i]
+		name := step.label(i)
+		if seen[name] {
+			return fmt.Errorf("Workflow %s has more than one step named %s", w.Name, name)
+		}
+		if err := w.validateStep(step, name, seen, config); err != nil {
+			return err
+		}
+		switch step.OnFailure {
+		case "", OnFailureStop, OnFailureContinue:
+		case OnFailureRollback:
+			if step.Rollback == nil {
+				return fmt.Errorf("Workflow %s step %s rolls back on failure but has no rollback step", w.Name, name)
+			}
+			if err := w.validateStep(step.Rollback, name+" rollback", seen, config); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Workflow %s step %s has unknown onfailure %s. Use stop, continue or rollback", w.Name, name, step.OnFailure)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// validateStep checks a step only references existing actions and earlier steps
+func (w *Workflow) validateStep(step *Step, name string, earlier map[string]bool, config *Config) error {
+	if (step.Action == "") == (step.Command == "") {
+		return fmt.Errorf("Workflow %s step %s needs either an action or a command", w.Name, name)
+	}
+	if step.Action != "" {
+		a := config.FindAction(step.Action)
+		if a == nil {
+			return fmt.Errorf("Workflow %s step %s runs unknown action %s", w.Name, name, step.Action)
+		}
+		// nobody could answer the step's confirmation or approval once the workflow is running
+		if a.Confirm.Enabled || a.RequiresApproval {
+			return fmt.Errorf("Workflow %s step %s can't run %s because it needs confirmation or approval", w.Name, name, step.Action)
+		}
+	}
+	for _, arg := range step.Args {
+		for _, match := range stepOutput.FindAllStringSubmatch(arg, -1) {
+			if !earlier[match[1]] {
+				return fmt.Errorf("Workflow %s step %s uses the output of %s which doesn't run before it", w.Name, name, match[1])
+			}
+		}
+	}
+	return nil
+}
+
+// expand replaces the workflow's params and the output of earlier steps in the step's args
+func (s *Step) expand(params []string, outputs map[string]Result) []string {
+	args := (&Action{Args: s.Args}).ParseArgs(params)
+	for i, arg := range args {
+		args[i] = stepOutput.ReplaceAllStringFunc(arg, func(reference string) string {
+			match := stepOutput.FindStringSubmatch(reference)
+			result := outputs[match[1]]
+			switch match[2] {
+			case "stdout":
+				return strings.TrimSpace(result.StdOut)
+			case "stderr":
+				return strings.TrimSpace(result.StdError)
+			default:
+				return strconv.Itoa(result.ReturnCode)
+			}
+		})
+	}
+	return args
+}
+
+// run executes the step's action or inline command. Inline commands get the workflow's env
+func (s *Step) run(ctx context.Context, config *Config, workflow *Action, params []string, outputs map[string]Result) (Result, error) {
+	args := s.expand(params, outputs)
+	if s.Command != "" {
+		inline := Action{Name: s.Name, Command: s.Command, Args: args, WorkingDir: s.WorkingDir, Timeout: s.Timeout, env: workflow.env, masker: workflow.masker}
+		return inline.RunContext(ctx)
+	}
+	a := config.FindAction(s.Action)
+	if a == nil {
+		return Result{ReturnCode: -1}, fmt.Errorf("Unknown action %s", s.Action)
+	}
+	values, err := a.ValidateParams(args)
+	if err != nil {
+		return Result{ReturnCode: -1, StdError: err.Error()}, err
+	}
+	return a.RunContext(ctx, values...)
+}
+
+// runStep runs a step once the user is allowed to run its action and the action's lock is taken.
+// Runs started by schedules and triggers skip the permission check like the workflow itself does
+func (b *Bot) runStep(ctx context.Context, request *Request, w *Workflow, step *Step, config *Config, params []string, outputs map[string]Result, queued func(position int)) (Result, error) {
+	if step.Action == "" {
+		return step.run(ctx, config, &w.Action, params, outputs)
+	}
+	a := config.FindAction(step.Action)
+	if a == nil {
+		return Result{ReturnCode: -1}, fmt.Errorf("Unknown action %s", step.Action)
+	}
+	if !request.system && !b.Permissions().Check(a, request.User, request.Channel).Allowed {
+		return Result{ReturnCode: -1}, fmt.Errorf("Not authorized to run %s", a.Name)
+	}
+	// the workflow already holds the lock when it shares it with the step's action
+	if key := a.LockKey(); key != "" && key != w.LockKey() {
+		if a.Concurrency == ConcurrencyQueue {
+			if err := b.Locks.Acquire(ctx, key, queued); err != nil {
+				return Result{ReturnCode: -1, Cancelled: true}, err
+			}
+		} else if !b.Locks.TryAcquire(key) {
+			return Result{ReturnCode: -1}, fmt.Errorf("%s is busy", a.Name)
+		}
+		defer b.Locks.Release(key)
+	}
+	return step.run(ctx, config, &w.Action, params, outputs)
+}
+
+// failed returns true when the step didn't succeed
+func failed(result Result, err error) bool {
+	return err != nil || result.ReturnCode != 0 || result.TimedOut || result.Cancelled
+}
+
+// workflowExecutor runs the steps of a workflow one after the other while keeping a
+// single message up to date with the status of every step
+func (b *Bot) workflowExecutor(w Workflow, config *Config) executor {
+	return func(ctx context.Context, request *Request, params []string, response Responder) (Result, bool, error) {
+		job := ctx
+		if w.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, w.Timeout)
+			defer cancel()
+		}
+
+		status := make([]string, len(w.Steps))
+		for i := range status {
+			status[i] = stepPending
+		}
+		notes := make([]string, len(w.Steps))
+		render := func() string {
+			text := fmt.Sprintf("*Workflow %s*\n", w.Name)
+			for i := range w.Steps {
+				text += status[i] + " " + w.Steps[i].label(i) + notes[i] + "\n"
+			}
+			return text
+		}
+		id, err := response.Reply(render())
+		update := func() {
+			if err == nil {
+				response.Edit(id, render())
+			}
+		}
+
+		outputs := map[string]Result{}
+		final := Result{}
+		var firstErr error
+		var output []string
+		for i := range w.Steps {
+			step := &w.Steps[i]
+			name := step.label(i)
+			if ctx.Err() != nil {
+				status[i] = stepSkipped
+				continue
+			}
+			status[i] = stepRunning
+			update()
+
+			result, runErr := b.runStep(ctx, request, &w, step, config, params, outputs, func(position int) {
+				notes[i] = fmt.Sprintf(" (queued at position %d)", position)
+				update()
+			})
+			notes[i] = ""
+			outputs[name] = result
+			output = append(output, fmt.Sprintf("== %s ==\n%s%s", name, result.StdOut, result.StdError))
+			if !failed(result, runErr) {
+				status[i] = stepSucceeded
+				continue
+			}
+
+			status[i] = stepFailed
+			notes[i] = fmt.Sprintf(" (exit code %d)", result.ReturnCode)
+			switch {
+			case result.TimedOut:
+				notes[i] = " (timed out)"
+			case result.ReturnCode == -1 && runErr != nil:
+				notes[i] = " (" + runErr.Error() + ")"
+			}
+			if final.ReturnCode == 0 {
+				final.ReturnCode = result.ReturnCode
+				if final.ReturnCode == 0 {
+					final.ReturnCode = -1
+				}
+				firstErr = runErr
+				if firstErr == nil {
+					firstErr = fmt.Errorf("Step %s failed", name)
+				}
+			}
+			final.TimedOut = final.TimedOut || result.TimedOut
+			final.Cancelled = final.Cancelled || result.Cancelled
+			if result.Cancelled || step.OnFailure == OnFailureContinue {
+				continue
+			}
+
+			if step.OnFailure == OnFailureRollback {
+				update()
+				// the rollback gets its own timeout since the failed step may have used up the workflow's,
+				// but cancelling the job still stops it
+				var rollbackCtx context.Context
+				var cancel context.CancelFunc
+				if w.Timeout > 0 {
+					rollbackCtx, cancel = context.WithTimeout(job, w.Timeout)
+				} else {
+					rollbackCtx, cancel = context.WithCancel(job)
+				}
+				note := notes[i]
+				rollback, rollbackErr := b.runStep(rollbackCtx, request, &w, step.Rollback, config, params, outputs, func(position int) {
+					notes[i] = note + fmt.Sprintf(", rollback queued at position %d", position)
+					update()
+				})
+				cancel()
+				output = append(output, fmt.Sprintf("== %s rollback ==\n%s%s", name, rollback.StdOut, rollback.StdError))
+				status[i] = stepRolled
+				notes[i] = note + ", rolled back"
+				if failed(rollback, rollbackErr) {
+					notes[i] += fmt.Sprintf(" but the rollback failed (exit code %d)", rollback.ReturnCode)
+				}
+				final.Cancelled = final.Cancelled || job.Err() == context.Canceled
+			}
+			for j := i + 1; j < len(w.Steps); j++ {
+				status[j] = stepSkipped
+			}
+			break
+		}
+		if ctx.Err() == context.DeadlineExceeded && !final.Cancelled {
+			final.TimedOut = true
+		}
+
+		final.StdOut = strings.Join(output, "\n")
+		if firstErr != nil {
+			final.StdError = firstErr.Error()
+		}
+		text := render() + fmt.Sprintf("*ExitCode: %d*", final.ReturnCode)
+		if err == nil {
+			response.Edit(id, text)
+		} else {
+			response.Reply(text)
+		}
+		return final, true, firstErr
+	}
+}
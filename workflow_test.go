@@ -0,0 +1,123 @@
+package slackchatops
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var workflowActions = []Action{
+	{Name: "build", Command: "sh", Args: []string{"-c", "echo build-{0}"}, Params: []Param{{Name: "version"}}},
+	{Name: "fail", Command: "sh", Args: []string{"-c", "echo broken >&2; exit 3"}},
+	{Name: "restricted", Command: "true", AuthorizedUsers: []string{"U2"}},
+	{Name: "approved", Command: "true", RequiresApproval: true, Approvers: []string{"U2"}},
+}
+
+func runWorkflow(t *testing.T, w Workflow, text string) (*fakeResponder, *Bot) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bot, cleanup := newTestBot(t, &Config{Actions: workflowActions, Workflows: []Workflow{w}})
+	defer cleanup()
+	response := &fakeResponder{}
+	bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: text}, response)
+	return response, bot
+}
+
+func TestWorkflowPassesOutput(t *testing.T) {
+	w := Workflow{Action: Action{Name: "release", Params: []Param{{Name: "version"}}}, Steps: []Step{
+		{Action: "build", Args: []string{"{0}"}},
+		{Name: "publish", Command: "sh", Args: []string{"-c", "echo published {steps.build.stdout} $0", "{steps.build.exitcode}"}},
+	}}
+	response, bot := runWorkflow(t, w, "release 1.2")
+
+	status := response.lastEdit()
+	if !strings.Contains(status, ":white_check_mark: build") || !strings.Contains(status, ":white_check_mark: publish") || !strings.Contains(status, "ExitCode: 0") {
+		t.Errorf("unexpected status %s", status)
+	}
+	run := bot.History.Recent("release", 1)[0]
+	if !strings.Contains(run.StdOut, "published build-1.2 0") {
+		t.Errorf("expected output of build to be passed to publish but got %s", run.StdOut)
+	}
+}
+
+func TestWorkflowFailurePolicies(t *testing.T) {
+	tests := []struct {
+		onFailure string
+		expected  []string
+	}{
+		{"", []string{":x: fail (exit code 3)", ":fast_forward: build", "ExitCode: 3"}},
+		{OnFailureContinue, []string{":x: fail (exit code 3)", ":white_check_mark: build", "ExitCode: 3"}},
+		{OnFailureRollback, []string{":leftwards_arrow_with_hook: fail (exit code 3), rolled back", ":fast_forward: build"}},
+	}
+	for _, test := range tests {
+		w := Workflow{Action: Action{Name: "deploy"}, Steps: []Step{
+			{Action: "fail", OnFailure: test.onFailure, Rollback: &Step{Command: "true"}},
+			{Action: "build", Args: []string{"x"}},
+		}}
+		response, _ := runWorkflow(t, w, "deploy")
+		status := response.lastEdit()
+		for _, expected := range test.expected {
+			if !strings.Contains(status, expected) {
+				t.Errorf("%q: expected status to contain %q but got %s", test.onFailure, expected, status)
+			}
+		}
+	}
+}
+
+func TestWorkflowChecksStepPermissions(t *testing.T) {
+	w := Workflow{Action: Action{Name: "deploy"}, Steps: []Step{{Action: "restricted"}, {Action: "build", Args: []string{"x"}}}}
+	response, _ := runWorkflow(t, w, "deploy")
+	if status := response.lastEdit(); !strings.Contains(status, ":x: restricted (Not authorized to run restricted)") || !strings.Contains(status, ":fast_forward: build") {
+		t.Errorf("expected the restricted step to be refused but got %s", status)
+	}
+}
+
+func TestWorkflowRollbackStopsWaitingForLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	cleanupAction := Action{Name: "cleanup", Command: "true", Concurrency: ConcurrencyQueue}
+	w := Workflow{Action: Action{Name: "deploy", Timeout: 300 * time.Millisecond}, Steps: []Step{
+		{Action: "fail", OnFailure: OnFailureRollback, Rollback: &Step{Action: "cleanup"}},
+	}}
+	bot, cleanup := newTestBot(t, &Config{Actions: append(append([]Action{}, workflowActions...), cleanupAction), Workflows: []Workflow{w}})
+	defer cleanup()
+	bot.Locks.TryAcquire(cleanupAction.LockKey())
+	defer bot.Locks.Release(cleanupAction.LockKey())
+
+	response := &fakeResponder{}
+	done := make(chan struct{})
+	go func() {
+		bot.Handle(context.Background(), Message{User: "U1", Channel: "C1", Text: "deploy"}, response)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the rollback to give up waiting for the lock once the workflow timed out")
+	}
+	if status := response.lastEdit(); !strings.Contains(status, "but the rollback failed") {
+		t.Errorf("expected the rollback to fail but got %s", status)
+	}
+}
+
+func TestWorkflowValidate(t *testing.T) {
+	config := &Config{Actions: workflowActions}
+	tests := []Workflow{
+		{Action: Action{Name: "empty"}},
+		{Action: Action{Name: "unknown"}, Steps: []Step{{Action: "nope"}}},
+		{Action: Action{Name: "both"}, Steps: []Step{{Action: "build", Command: "ls"}}},
+		{Action: Action{Name: "later"}, Steps: []Step{{Command: "echo", Args: []string{"{steps.b.stdout}"}}, {Name: "b", Command: "ls"}}},
+		{Action: Action{Name: "norollback"}, Steps: []Step{{Command: "ls", OnFailure: OnFailureRollback}}},
+		{Action: Action{Name: "unusedparam", Params: []Param{{Name: "v"}}}, Steps: []Step{{Command: "ls"}}},
+		{Action: Action{Name: "approval"}, Steps: []Step{{Action: "approved"}}},
+	}
+	for _, w := range tests {
+		if err := w.Validate(config); err == nil {
+			t.Errorf("expected workflow %s to be invalid", w.Name)
+		}
+	}
+}